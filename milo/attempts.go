@@ -0,0 +1,40 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package milo
+
+import "sync"
+
+// startAttempts counts how often each task of an allocation has been started.
+// Nomad calls StartTask again with a new task ID for every restart of a task
+// but does not tell the driver which attempt it is, so the driver counts them
+// itself. Counts are kept for the life of the plugin.
+type startAttempts struct {
+	counts map[string]int
+	lock   sync.Mutex
+}
+
+func newStartAttempts() *startAttempts {
+	return &startAttempts{counts: make(map[string]int)}
+}
+
+// Record records a start of the named task of an allocation and returns its
+// attempt number, starting at 1.
+func (a *startAttempts) Record(allocID, name string) int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	key := allocID + "/" + name
+	a.counts[key]++
+	return a.counts[key]
+}
+
+// Restore records the attempt number of a recovered task, so that later
+// starts of the task are numbered after it.
+func (a *startAttempts) Restore(allocID, name string, attempt int) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	key := allocID + "/" + name
+	a.counts[key] = max(a.counts[key], attempt)
+}
@@ -11,10 +11,16 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/hashicorp/consul-template/signals"
 	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/client/lib/cgroupslib"
 	"github.com/hashicorp/nomad/drivers/shared/eventer"
 	"github.com/hashicorp/nomad/drivers/shared/executor"
 	"github.com/hashicorp/nomad/plugins/base"
@@ -42,6 +48,17 @@ const (
 	// this is used to allow modification and migration of the task schema
 	// used by the plugin
 	taskHandleVersion = 1
+
+	// pauseSignal and resumeSignal are pseudo signal names accepted by
+	// SignalTask to freeze and thaw a task without stopping it
+	pauseSignal  = "PAUSE"
+	resumeSignal = "RESUME"
+
+	// maxArgLen and maxArgsSize are the Linux limits on the length of a
+	// single argument (MAX_ARG_STRLEN) and on all arguments together (the
+	// default ARG_MAX) that a process can be executed with
+	maxArgLen   = 128 * 1024
+	maxArgsSize = 2 * 1024 * 1024
 )
 
 var (
@@ -75,6 +92,44 @@ var (
 			hclspec.NewAttr("shell", "string", false),
 			hclspec.NewLiteral(`"bash"`),
 		),
+		"destroy_grace_period": hclspec.NewDefault(
+			hclspec.NewAttr("destroy_grace_period", "string", false),
+			hclspec.NewLiteral(`"5s"`),
+		),
+		"stop_verify_timeout": hclspec.NewDefault(
+			hclspec.NewAttr("stop_verify_timeout", "string", false),
+			hclspec.NewLiteral(`"5s"`),
+		),
+		"min_stop_timeout": hclspec.NewDefault(
+			hclspec.NewAttr("min_stop_timeout", "string", false),
+			hclspec.NewLiteral(`"0s"`),
+		),
+		"stop_signal_sequence": hclspec.NewAttr("stop_signal_sequence", "list(string)", false),
+		"stop_signal_interval": hclspec.NewDefault(
+			hclspec.NewAttr("stop_signal_interval", "string", false),
+			hclspec.NewLiteral(`"5s"`),
+		),
+		"start_summary_path": hclspec.NewAttr("start_summary_path", "string", false),
+		"min_free_disk": hclspec.NewDefault(
+			hclspec.NewAttr("min_free_disk", "number", false),
+			hclspec.NewLiteral(`0`),
+		),
+		"start_failure_threshold": hclspec.NewDefault(
+			hclspec.NewAttr("start_failure_threshold", "number", false),
+			hclspec.NewLiteral(`5`),
+		),
+		"start_failure_window": hclspec.NewDefault(
+			hclspec.NewAttr("start_failure_window", "string", false),
+			hclspec.NewLiteral(`"5m"`),
+		),
+		"min_nice": hclspec.NewDefault(
+			hclspec.NewAttr("min_nice", "number", false),
+			hclspec.NewLiteral(`0`),
+		),
+		"allow_liveness_probes": hclspec.NewDefault(
+			hclspec.NewAttr("allow_liveness_probes", "bool", false),
+			hclspec.NewLiteral(`false`),
+		),
 	})
 
 	// taskConfigSpec is the specification of the plugin's configuration for
@@ -103,6 +158,19 @@ var (
 			hclspec.NewAttr("greeting", "string", false),
 			hclspec.NewLiteral(`"Hello, World!"`),
 		),
+		"nice":               hclspec.NewAttr("nice", "number", false),
+		"success_exit_codes": hclspec.NewAttr("success_exit_codes", "list(number)", false),
+		"liveness": hclspec.NewBlock("liveness", false, hclspec.NewObject(map[string]*hclspec.Spec{
+			"command": hclspec.NewAttr("command", "list(string)", true),
+			"interval": hclspec.NewDefault(
+				hclspec.NewAttr("interval", "string", false),
+				hclspec.NewLiteral(`"10s"`),
+			),
+			"failure_threshold": hclspec.NewDefault(
+				hclspec.NewAttr("failure_threshold", "number", false),
+				hclspec.NewLiteral(`3`),
+			),
+		})),
 	})
 
 	// capabilities indicates what optional features this driver supports
@@ -126,6 +194,60 @@ type Config struct {
 	// configSpec variable above. It's used to convert the HCL configuration
 	// passed by the Nomad agent into Go contructs.
 	Shell string `codec:"shell"`
+
+	// DestroyGracePeriod is how long a forced DestroyTask waits for a still
+	// running task to exit after signalling it before killing it.
+	DestroyGracePeriod string        `codec:"destroy_grace_period"`
+	destroyGracePeriod time.Duration `codec:"-"`
+
+	// StopVerifyTimeout is how long StopTask waits for the task to be seen
+	// exiting after the executor failed to shut it down before force killing
+	// it. Zero disables the check.
+	StopVerifyTimeout string        `codec:"stop_verify_timeout"`
+	stopVerifyTimeout time.Duration `codec:"-"`
+
+	// MinStopTimeout is the smallest graceful window StopTask gives a task
+	// before killing it, regardless of the timeout it is called with.
+	MinStopTimeout string        `codec:"min_stop_timeout"`
+	minStopTimeout time.Duration `codec:"-"`
+
+	// StopSignalSequence lists signals StopTask sends to a task, in order and
+	// StopSignalInterval apart, before the stop signal given by Nomad. This
+	// lets applications start draining connections ahead of shutdown. The
+	// sequence runs within the stop timeout, and a sequence ending with the
+	// stop signal does not get it sent a second time.
+	StopSignalSequence []string      `codec:"stop_signal_sequence"`
+	stopSignals        []os.Signal   `codec:"-"`
+	StopSignalInterval string        `codec:"stop_signal_interval"`
+	stopSignalInterval time.Duration `codec:"-"`
+
+	// StartSummaryPath is where a JSON summary of each launched task is
+	// written. It may reference ${NOMAD_ALLOC_ID}, ${NOMAD_JOB_NAME} and
+	// ${NOMAD_TASK_NAME}, e.g.
+	// "/var/lib/milo/${NOMAD_ALLOC_ID}-${NOMAD_TASK_NAME}.json". Empty
+	// disables the summary.
+	StartSummaryPath string `codec:"start_summary_path"`
+
+	// MinFreeDisk is the number of bytes that must be free in the task
+	// directory for a task to be started. Zero disables the check.
+	MinFreeDisk int64 `codec:"min_free_disk"`
+
+	// StartFailureThreshold is the number of task start failures within
+	// StartFailureWindow after which the driver reports itself unhealthy.
+	// Zero disables the check.
+	StartFailureThreshold int           `codec:"start_failure_threshold"`
+	StartFailureWindow    string        `codec:"start_failure_window"`
+	startFailureWindow    time.Duration `codec:"-"`
+
+	// MinNice is the lowest nice value, and so the highest scheduling
+	// priority, a task may ask for. It defaults to 0 so that jobs can only
+	// lower their priority on shared nodes.
+	MinNice int `codec:"min_nice"`
+
+	// AllowLivenessProbes lets jobs configure a liveness probe. Probes run
+	// on the node as the task's user, so they are off unless the operator
+	// enables them.
+	AllowLivenessProbes bool `codec:"allow_liveness_probes"`
 }
 
 // TaskConfig contains configuration information for a task that runs with
@@ -137,6 +259,54 @@ type TaskConfig struct {
 	// taskConfigSpec variable above. It's used to convert the string
 	// configuration for the task into Go contructs.
 	Greeting string `codec:"greeting"`
+
+	// Nice is the scheduling priority adjustment the task process is
+	// started with, from -20 (highest priority) to 19 (lowest).
+	Nice int `codec:"nice"`
+
+	// SuccessExitCodes lists the exit codes that count as a successful run.
+	// When set, every other exit code, including 0, is a failure.
+	SuccessExitCodes []int `codec:"success_exit_codes"`
+
+	// Liveness is an optional probe that stops the task when it keeps failing.
+	Liveness *LivenessConfig `codec:"liveness"`
+}
+
+// ValidateTaskConfig checks a decoded task configuration for invalid values
+// or combinations of values that the HCL schema cannot express.
+func ValidateTaskConfig(cfg TaskConfig) error {
+	if cfg.Nice < -20 || cfg.Nice > 19 {
+		return fmt.Errorf("nice %d must be between -20 and 19", cfg.Nice)
+	}
+	if cfg.Nice != 0 && !niceSupported {
+		return fmt.Errorf("nice is not supported on this platform")
+	}
+
+	for _, code := range cfg.SuccessExitCodes {
+		if code < 0 || code > 255 {
+			return fmt.Errorf("success exit code %d must be between 0 and 255", code)
+		}
+	}
+
+	if cfg.Liveness != nil {
+		if err := cfg.Liveness.validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkTaskConfigAllowed checks a valid task configuration against the
+// limits the operator set in the plugin config.
+func (d *MiloDriverPlugin) checkTaskConfigAllowed(cfg TaskConfig) error {
+	if cfg.Nice < d.config.MinNice {
+		return fmt.Errorf("nice %d is below the minimum of %d allowed on this client", cfg.Nice, d.config.MinNice)
+	}
+	if cfg.Liveness != nil && !d.config.AllowLivenessProbes {
+		return fmt.Errorf("liveness probes are not allowed on this client")
+	}
+	return nil
 }
 
 // TaskState is the runtime state which is encoded in the handle returned to
@@ -157,6 +327,9 @@ type TaskState struct {
 	// in-memory representation of the running tasks using the RecoverTask()
 	// method below.
 	Pid int
+
+	// Attempt is how many times the task has been started in its allocation
+	Attempt int
 }
 
 // MiloDriverPlugin is an example driver plugin. When provisioned in a job,
@@ -175,6 +348,19 @@ type MiloDriverPlugin struct {
 	// tasks is the in memory datastore mapping taskIDs to driver handles
 	tasks *taskStore
 
+	// startFailures tracks recent task start failures used to report the
+	// driver as unhealthy
+	startFailures *startFailureTracker
+
+	// startAttempts counts the starts of each task of an allocation, used
+	// to report restarts
+	startAttempts *startAttempts
+
+	// startsTotal and startsFailed count all task start attempts and the
+	// failed ones, reported as fingerprint attributes
+	startsTotal  atomic.Int64
+	startsFailed atomic.Int64
+
 	// ctx is the context for the driver. It is passed to other subsystems to
 	// coordinate shutdown
 	ctx context.Context
@@ -196,6 +382,8 @@ func NewPlugin(logger hclog.Logger) drivers.DriverPlugin {
 		eventer:        eventer.NewEventer(ctx, logger),
 		config:         &Config{},
 		tasks:          newTaskStore(),
+		startFailures:  newStartFailureTracker(),
+		startAttempts:  newStartAttempts(),
 		ctx:            ctx,
 		signalShutdown: cancel,
 		logger:         logger,
@@ -224,6 +412,18 @@ func (d *MiloDriverPlugin) SetConfig(cfg *base.Config) error {
 	// Save the configuration to the plugin
 	d.config = &config
 
+	// Nomad negotiates the plugin API version with the client before calling
+	// SetConfig. A version this plugin does not advertise means the agent is
+	// incompatible, which otherwise only shows up as cryptic RPC failures.
+	if cfg.ApiVersion != "" {
+		if slices.Contains(pluginInfo.PluginApiVersions, cfg.ApiVersion) {
+			d.logger.Debug("negotiated plugin API version", "api_version", cfg.ApiVersion)
+		} else {
+			d.logger.Warn("Nomad negotiated a plugin API version this driver does not support",
+				"api_version", cfg.ApiVersion, "supported_versions", pluginInfo.PluginApiVersions)
+		}
+	}
+
 	// TODO: parse and validated any configuration value if necessary.
 	//
 	// If your driver agent configuration requires any complex validation
@@ -238,6 +438,75 @@ func (d *MiloDriverPlugin) SetConfig(cfg *base.Config) error {
 		return fmt.Errorf("invalid shell %s", d.config.Shell)
 	}
 
+	if d.config.DestroyGracePeriod != "" {
+		grace, err := time.ParseDuration(d.config.DestroyGracePeriod)
+		if err != nil {
+			return fmt.Errorf("invalid destroy_grace_period %q: %v", d.config.DestroyGracePeriod, err)
+		}
+		d.config.destroyGracePeriod = grace
+	}
+
+	if d.config.StopVerifyTimeout != "" {
+		timeout, err := time.ParseDuration(d.config.StopVerifyTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid stop_verify_timeout %q: %v", d.config.StopVerifyTimeout, err)
+		}
+		d.config.stopVerifyTimeout = timeout
+	}
+
+	if d.config.MinStopTimeout != "" {
+		timeout, err := time.ParseDuration(d.config.MinStopTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid min_stop_timeout %q: %v", d.config.MinStopTimeout, err)
+		}
+		d.config.minStopTimeout = timeout
+	}
+
+	for _, name := range d.config.StopSignalSequence {
+		sig, ok := signals.SignalLookup[name]
+		if !ok {
+			return fmt.Errorf("invalid stop_signal_sequence: unknown signal %q", name)
+		}
+		d.config.stopSignals = append(d.config.stopSignals, sig)
+	}
+
+	if d.config.StopSignalInterval != "" {
+		interval, err := time.ParseDuration(d.config.StopSignalInterval)
+		if err != nil {
+			return fmt.Errorf("invalid stop_signal_interval %q: %v", d.config.StopSignalInterval, err)
+		}
+		d.config.stopSignalInterval = interval
+	}
+	if len(d.config.stopSignals) > 0 && d.config.stopSignalInterval <= 0 {
+		return fmt.Errorf("invalid stop_signal_interval %q: must be positive when stop_signal_sequence is set", d.config.StopSignalInterval)
+	}
+
+	if d.config.StartSummaryPath != "" {
+		if err := validateStartSummaryPath(d.config.StartSummaryPath); err != nil {
+			return fmt.Errorf("invalid start_summary_path %q: %v", d.config.StartSummaryPath, err)
+		}
+	}
+
+	if d.config.MinNice < -20 || d.config.MinNice > 19 {
+		return fmt.Errorf("invalid min_nice %d: must be between -20 and 19", d.config.MinNice)
+	}
+
+	if d.config.MinFreeDisk < 0 {
+		return fmt.Errorf("invalid min_free_disk %d: must not be negative", d.config.MinFreeDisk)
+	}
+
+	if d.config.StartFailureThreshold < 0 {
+		return fmt.Errorf("invalid start_failure_threshold %d: must not be negative", d.config.StartFailureThreshold)
+	}
+
+	if d.config.StartFailureWindow != "" {
+		window, err := time.ParseDuration(d.config.StartFailureWindow)
+		if err != nil {
+			return fmt.Errorf("invalid start_failure_window %q: %v", d.config.StartFailureWindow, err)
+		}
+		d.config.startFailureWindow = window
+	}
+
 	// Save the Nomad agent configuration
 	if cfg.AgentConfig != nil {
 		d.nomadConfig = cfg.AgentConfig.Driver
@@ -293,11 +562,21 @@ func (d *MiloDriverPlugin) handleFingerprint(ctx context.Context, ch chan<- *dri
 // buildFingerprint returns the driver's fingerprint data
 func (d *MiloDriverPlugin) buildFingerprint() *drivers.Fingerprint {
 	fp := &drivers.Fingerprint{
-		Attributes:        map[string]*structs.Attribute{},
+		Attributes: map[string]*structs.Attribute{
+			"driver.milo.starts_total":  structs.NewIntAttribute(d.startsTotal.Load(), ""),
+			"driver.milo.starts_failed": structs.NewIntAttribute(d.startsFailed.Load(), ""),
+		},
 		Health:            drivers.HealthStateHealthy,
 		HealthDescription: drivers.DriverHealthy,
 	}
 
+	// Stop accepting tasks if they keep failing to start on this node
+	threshold, window := d.config.StartFailureThreshold, d.config.startFailureWindow
+	if unhealthy, reason := d.startFailures.Unhealthy(threshold, window, time.Now()); unhealthy {
+		fp.Health = drivers.HealthStateUnhealthy
+		fp.HealthDescription = fmt.Sprintf("%d or more tasks failed to start within %s: %s", threshold, window, reason)
+	}
+
 	// TODO: implement fingerprinting logic to populate health and driver
 	// attributes.
 	//
@@ -324,6 +603,15 @@ func (d *MiloDriverPlugin) buildFingerprint() *drivers.Fingerprint {
 		}
 	}
 
+	// Report the cgroup hierarchy the node uses so that jobs can constrain
+	// on it
+	switch cgroupslib.GetMode() {
+	case cgroupslib.CG1:
+		fp.Attributes["driver.milo.cgroup_version"] = structs.NewStringAttribute("1")
+	case cgroupslib.CG2:
+		fp.Attributes["driver.milo.cgroup_version"] = structs.NewStringAttribute("2")
+	}
+
 	// We also set the shell and its version as attributes
 	cmd = exec.Command(shell, "--version")
 	if out, err := cmd.Output(); err != nil {
@@ -341,6 +629,16 @@ func (d *MiloDriverPlugin) buildFingerprint() *drivers.Fingerprint {
 
 // StartTask returns a task handle and a driver network if necessary.
 func (d *MiloDriverPlugin) StartTask(cfg *drivers.TaskConfig) (*drivers.TaskHandle, *drivers.DriverNetwork, error) {
+	d.startsTotal.Add(1)
+	handle, network, err := d.startTask(cfg)
+	if err != nil {
+		d.startsFailed.Add(1)
+	}
+	return handle, network, err
+}
+
+// startTask implements StartTask.
+func (d *MiloDriverPlugin) startTask(cfg *drivers.TaskConfig) (*drivers.TaskHandle, *drivers.DriverNetwork, error) {
 	if _, ok := d.tasks.Get(cfg.ID); ok {
 		return nil, nil, fmt.Errorf("task with ID %q already started", cfg.ID)
 	}
@@ -350,6 +648,19 @@ func (d *MiloDriverPlugin) StartTask(cfg *drivers.TaskConfig) (*drivers.TaskHand
 		return nil, nil, fmt.Errorf("failed to decode driver config: %v", err)
 	}
 
+	if err := ValidateTaskConfig(driverConfig); err != nil {
+		return nil, nil, fmt.Errorf("invalid driver config: %v", err)
+	}
+	if err := d.checkTaskConfigAllowed(driverConfig); err != nil {
+		return nil, nil, fmt.Errorf("invalid driver config: %v", err)
+	}
+
+	if err := d.checkFreeDisk(cfg.TaskDir().Dir); err != nil {
+		d.writeTaskStderr(cfg, err)
+		d.startFailures.RecordFailure(err.Error())
+		return nil, nil, err
+	}
+
 	d.logger.Info("starting task", "driver_cfg", hclog.Fmt("%+v", driverConfig))
 	handle := drivers.NewTaskHandle(taskHandleVersion)
 	handle.Config = cfg
@@ -375,23 +686,27 @@ func (d *MiloDriverPlugin) StartTask(cfg *drivers.TaskConfig) (*drivers.TaskHand
 		LogLevel: "debug",
 	}
 
-	exec, pluginClient, err := executor.CreateExecutor(d.logger, d.nomadConfig, executorConfig)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create executor: %v", err)
+	execCmd := d.buildExecCommand(cfg, driverConfig)
+	if err := validateExecCommandSize(execCmd); err != nil {
+		d.writeTaskStderr(cfg, err)
+		return nil, nil, err
 	}
 
-	echoCmd := fmt.Sprintf(`echo "%s"`, driverConfig.Greeting)
-	execCmd := &executor.ExecCommand{
-		Cmd:        d.config.Shell,
-		Args:       []string{"-c", echoCmd},
-		StdoutPath: cfg.StdoutPath,
-		StderrPath: cfg.StderrPath,
+	exec, pluginClient, err := executor.CreateExecutor(d.logger, d.nomadConfig, executorConfig)
+	if err != nil {
+		err = fmt.Errorf("failed to create executor: %v", err)
+		d.writeTaskStderr(cfg, err)
+		d.startFailures.RecordFailure(err.Error())
+		return nil, nil, err
 	}
 
 	ps, err := exec.Launch(execCmd)
 	if err != nil {
 		pluginClient.Kill()
-		return nil, nil, fmt.Errorf("failed to launch command with executor: %v", err)
+		err = fmt.Errorf("failed to launch command with executor: %v", err)
+		d.writeTaskStderr(cfg, err)
+		d.startFailures.RecordFailure(err.Error())
+		return nil, nil, err
 	}
 
 	h := &taskHandle{
@@ -401,7 +716,12 @@ func (d *MiloDriverPlugin) StartTask(cfg *drivers.TaskConfig) (*drivers.TaskHand
 		taskConfig:   cfg,
 		procState:    drivers.TaskStateRunning,
 		startedAt:    time.Now().Round(time.Millisecond),
+		attempt:      d.startAttempts.Record(cfg.AllocID, cfg.Name),
 		logger:       d.logger,
+		eventer:      d.eventer,
+		doneCh:       make(chan struct{}),
+
+		successExitCodes: driverConfig.SuccessExitCodes,
 	}
 
 	driverState := TaskState{
@@ -409,17 +729,130 @@ func (d *MiloDriverPlugin) StartTask(cfg *drivers.TaskConfig) (*drivers.TaskHand
 		Pid:            ps.Pid,
 		TaskConfig:     cfg,
 		StartedAt:      h.startedAt,
+		Attempt:        h.attempt,
 	}
 
 	if err := handle.SetDriverState(&driverState); err != nil {
 		return nil, nil, fmt.Errorf("failed to set driver state: %v", err)
 	}
 
+	if err := d.writeStartSummary(cfg, execCmd, h); err != nil {
+		d.logger.Warn("failed to write start summary", "task_id", cfg.ID, "error", err)
+	}
+
 	d.tasks.Set(cfg.ID, h)
+	d.startFailures.RecordSuccess()
+	h.emitStartEvent()
 	go h.run()
+	if driverConfig.Liveness != nil {
+		go d.watchLiveness(h, driverConfig.Liveness)
+	}
 	return handle, nil, nil
 }
 
+// buildExecCommand returns the command the executor launches for a task.
+func (d *MiloDriverPlugin) buildExecCommand(cfg *drivers.TaskConfig, driverConfig TaskConfig) *executor.ExecCommand {
+	// The greeting is passed as a positional parameter rather than
+	// interpolated into the script, so the shell never interprets it.
+	execCmd := &executor.ExecCommand{
+		Cmd:        d.config.Shell,
+		Args:       []string{"-c", `echo "$1"`, pluginName, driverConfig.Greeting},
+		StdoutPath: cfg.StdoutPath,
+		StderrPath: cfg.StderrPath,
+	}
+
+	// The executor cannot set the scheduling priority itself, so the task is
+	// started through nice(1) instead.
+	if driverConfig.Nice != 0 {
+		execCmd.Args = append([]string{"-n", strconv.Itoa(driverConfig.Nice), execCmd.Cmd}, execCmd.Args...)
+		execCmd.Cmd = "nice"
+	}
+
+	return execCmd
+}
+
+// validateExecCommandSize rejects commands the kernel would refuse to execute
+// because their arguments are too large, which would otherwise only surface
+// as an E2BIG error from deep inside the executor.
+func validateExecCommandSize(execCmd *executor.ExecCommand) error {
+	total := len(execCmd.Cmd) + 1
+	for _, arg := range execCmd.Args {
+		if len(arg) >= maxArgLen {
+			return fmt.Errorf("task command argument is %d bytes, more than the %d bytes allowed for a single argument; move large values into a file, e.g. with a template block", len(arg), maxArgLen)
+		}
+		total += len(arg) + 1
+	}
+	if total > maxArgsSize {
+		return fmt.Errorf("task command is %d bytes, more than the %d bytes allowed for all arguments; move large values into a file, e.g. with a template block", total, maxArgsSize)
+	}
+	return nil
+}
+
+// sendStopSignals sends the configured stop_signal_sequence to the task,
+// waiting stop_signal_interval after each signal, and stops once the deadline
+// is reached. It returns true if the task exited during the sequence, along
+// with the last signal that was sent.
+func (d *MiloDriverPlugin) sendStopSignals(handle *taskHandle, deadline time.Time) (bool, os.Signal) {
+	var last os.Signal
+	for _, sig := range d.config.stopSignals {
+		wait := min(d.config.stopSignalInterval, time.Until(deadline))
+		if wait <= 0 {
+			break
+		}
+
+		if err := handle.exec.Signal(sig); err != nil {
+			d.logger.Warn("failed to send stop sequence signal to task", "task_id", handle.taskConfig.ID, "signal", sig, "error", err)
+			continue
+		}
+		last = sig
+
+		select {
+		case <-handle.doneCh:
+			return true, last
+		case <-time.After(wait):
+		}
+	}
+	return false, last
+}
+
+// checkFreeDisk returns an error if less than the configured min_free_disk
+// bytes are available to unprivileged users in dir.
+func (d *MiloDriverPlugin) checkFreeDisk(dir string) error {
+	if d.config.MinFreeDisk <= 0 {
+		return nil
+	}
+
+	free, err := freeDiskSpace(dir)
+	if err != nil {
+		return fmt.Errorf("failed to check free disk space in %s: %v", dir, err)
+	}
+	if free < d.config.MinFreeDisk {
+		return fmt.Errorf("insufficient disk space in %s: %d bytes free, %d required", dir, free, d.config.MinFreeDisk)
+	}
+	return nil
+}
+
+// writeTaskStderr writes a start failure to the task's stderr so that it is
+// visible through `nomad alloc logs -stderr` and not only in the agent log.
+// The file is opened non-blocking so that a FIFO without a reader attached
+// fails immediately instead of hanging StartTask.
+func (d *MiloDriverPlugin) writeTaskStderr(cfg *drivers.TaskConfig, taskErr error) {
+	if cfg.StderrPath == "" {
+		return
+	}
+
+	f, err := os.OpenFile(cfg.StderrPath, os.O_WRONLY|os.O_APPEND|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		d.logger.Warn("failed to open task stderr to report start failure", "task_id", cfg.ID, "error", err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := fmt.Fprintf(f, "%s: %v\n", pluginName, taskErr); err != nil {
+		d.logger.Warn("failed to write start failure to task stderr", "task_id", cfg.ID, "error", err)
+	}
+}
+
 // RecoverTask recreates the in-memory state of a task from a TaskHandle.
 func (d *MiloDriverPlugin) RecoverTask(handle *drivers.TaskHandle) error {
 	if handle == nil {
@@ -464,12 +897,28 @@ func (d *MiloDriverPlugin) RecoverTask(handle *drivers.TaskHandle) error {
 		taskConfig:   taskState.TaskConfig,
 		procState:    drivers.TaskStateRunning,
 		startedAt:    taskState.StartedAt,
+		attempt:      taskState.Attempt,
 		exitResult:   &drivers.ExitResult{},
+		logger:       d.logger,
+		eventer:      d.eventer,
+		doneCh:       make(chan struct{}),
+
+		successExitCodes: driverConfig.SuccessExitCodes,
+	}
+
+	// The paused state is not part of the task state, so a task that was
+	// paused before the plugin restarted is recognised by its stopped process
+	if h.pid > 0 && processStopped(h.pid) {
+		h.paused = true
 	}
 
+	d.startAttempts.Restore(taskState.TaskConfig.AllocID, taskState.TaskConfig.Name, taskState.Attempt)
 	d.tasks.Set(taskState.TaskConfig.ID, h)
 
 	go h.run()
+	if driverConfig.Liveness != nil && d.config.AllowLivenessProbes {
+		go d.watchLiveness(h, driverConfig.Liveness)
+	}
 	return nil
 }
 
@@ -505,10 +954,7 @@ func (d *MiloDriverPlugin) handleWait(ctx context.Context, handle *taskHandle, c
 			Err: fmt.Errorf("executor: error waiting on process: %v", err),
 		}
 	} else {
-		result = &drivers.ExitResult{
-			ExitCode: ps.ExitCode,
-			Signal:   ps.Signal,
-		}
+		result = handle.newExitResult(ps)
 	}
 
 	for {
@@ -538,16 +984,99 @@ func (d *MiloDriverPlugin) StopTask(taskID string, timeout time.Duration, signal
 	// In the example below we let the executor handle the task shutdown
 	// process for us, but you might need to customize this for your own
 	// implementation.
+	handle.stopRequested.Store(true)
+	return d.stopTask(handle, timeout, signal)
+}
+
+// stopTask stops the task of the handle. Unlike StopTask it does not mark
+// the stop as requested, so that the driver can stop unhealthy tasks without
+// their exit being reported as an intentional stop.
+func (d *MiloDriverPlugin) stopTask(handle *taskHandle, timeout time.Duration, signal string) error {
+	taskID := handle.taskConfig.ID
+
+	// A paused task cannot act on the stop signal, so it is resumed first.
+	if handle.IsPaused() {
+		if err := d.ResumeTask(taskID); err != nil {
+			d.logger.Warn("failed to resume paused task before stopping it", "task_id", taskID, "error", err)
+		}
+	}
+
+	if timeout < d.config.minStopTimeout {
+		timeout = d.config.minStopTimeout
+	}
+
+	// The signal sequence takes its time out of the stop timeout
+	var last os.Signal
+	if len(d.config.stopSignals) > 0 {
+		deadline := time.Now().Add(timeout)
+		var exited bool
+		exited, last = d.sendStopSignals(handle, deadline)
+		if exited {
+			return nil
+		}
+		timeout = max(time.Until(deadline), 0)
+	}
+
+	// A sequence ending with the stop signal already sent it, so the task is
+	// only given the rest of the timeout before it is killed
+	if last != nil && last == signals.SignalLookup[signal] {
+		select {
+		case <-handle.doneCh:
+			return nil
+		case <-time.After(timeout):
+		}
+		timeout = 0
+	}
+
 	if err := handle.exec.Shutdown(signal, timeout); err != nil {
 		if handle.pluginClient.Exited() {
 			return nil
 		}
+
+		// The executor gives up on a task that has not exited a while after
+		// being killed, so make sure it is really gone and kill it again if
+		// it lingers.
+		if d.forceKillLingering(handle) {
+			return nil
+		}
 		return fmt.Errorf("executor Shutdown failed: %v", err)
 	}
 
 	return nil
 }
 
+// forceKillLingering waits up to stop_verify_timeout for a task the executor
+// failed to shut down to exit, and sends it SIGKILL if it is still running.
+// It returns true once the task has exited.
+func (d *MiloDriverPlugin) forceKillLingering(handle *taskHandle) bool {
+	if d.config.stopVerifyTimeout <= 0 {
+		return false
+	}
+
+	select {
+	case <-handle.doneCh:
+		return true
+	case <-time.After(d.config.stopVerifyTimeout):
+	}
+
+	taskID := handle.taskConfig.ID
+	d.logger.Warn("task still running after shutdown, force killing it", "task_id", taskID)
+	if err := handle.exec.Signal(os.Kill); err != nil {
+		d.logger.Error("failed to force kill task", "task_id", taskID, "error", err)
+		return false
+	}
+	handle.emitEvent("Task did not exit after being stopped and was force killed", map[string]string{
+		"force_killed": "true",
+	})
+
+	select {
+	case <-handle.doneCh:
+		return true
+	case <-time.After(d.config.stopVerifyTimeout):
+		return false
+	}
+}
+
 // DestroyTask cleans up and removes a task that has terminated.
 func (d *MiloDriverPlugin) DestroyTask(taskID string, force bool) error {
 	handle, ok := d.tasks.Get(taskID)
@@ -565,9 +1094,31 @@ func (d *MiloDriverPlugin) DestroyTask(taskID string, force bool) error {
 	// local references in the plugin. If force is set to true the task should
 	// be destroyed even if it's currently running.
 	//
-	// In the example below we use the executor to force shutdown the task
-	// (timeout equals 0).
+	// A task that is still running is first given the configured grace
+	// period to exit on its own before the executor force kills it.
 	if !handle.pluginClient.Exited() {
+		if handle.IsRunning() {
+			handle.stopRequested.Store(true)
+
+			// A paused task cannot act on SIGTERM, so it is resumed first
+			if handle.IsPaused() {
+				if err := d.ResumeTask(taskID); err != nil {
+					d.logger.Warn("failed to resume paused task before destroying it", "task_id", taskID, "error", err)
+				}
+			}
+
+			forceKilled := d.signalAndWait(handle, d.config.destroyGracePeriod)
+			d.logger.Debug("destroying running task", "task_id", taskID, "force_killed", forceKilled)
+
+			msg := "Task exited within the destroy grace period"
+			if forceKilled {
+				msg = "Task did not exit within the destroy grace period and was force killed"
+			}
+			handle.emitEvent(msg, map[string]string{
+				"force_killed": strconv.FormatBool(forceKilled),
+			})
+		}
+
 		if err := handle.exec.Shutdown("", 0); err != nil {
 			handle.logger.Error("destroying executor failed", "err", err)
 		}
@@ -579,6 +1130,27 @@ func (d *MiloDriverPlugin) DestroyTask(taskID string, force bool) error {
 	return nil
 }
 
+// signalAndWait sends SIGTERM to a running task and waits up to grace for it
+// to exit. It returns true if the task is still running afterwards and has to
+// be force killed.
+func (d *MiloDriverPlugin) signalAndWait(handle *taskHandle, grace time.Duration) bool {
+	if grace <= 0 {
+		return true
+	}
+
+	if err := handle.exec.Signal(syscall.SIGTERM); err != nil {
+		d.logger.Warn("failed to signal task", "task_id", handle.taskConfig.ID, "error", err)
+		return true
+	}
+
+	select {
+	case <-handle.doneCh:
+		return false
+	case <-time.After(grace):
+		return true
+	}
+}
+
 // InspectTask returns detailed status information for the referenced taskID.
 func (d *MiloDriverPlugin) InspectTask(taskID string) (*drivers.TaskStatus, error) {
 	handle, ok := d.tasks.Get(taskID)
@@ -589,6 +1161,30 @@ func (d *MiloDriverPlugin) InspectTask(taskID string) (*drivers.TaskStatus, erro
 	return handle.TaskStatus(), nil
 }
 
+// TaskSummary describes a task managed by the driver, as returned by
+// ListTasks.
+type TaskSummary struct {
+	ID        string
+	PID       int
+	StartedAt time.Time
+	State     drivers.TaskState
+	Paused    bool
+}
+
+// ListTasks returns a snapshot of the tasks the driver is currently
+// managing, sorted by task ID.
+func (d *MiloDriverPlugin) ListTasks() []TaskSummary {
+	handles := d.tasks.List()
+	summaries := make([]TaskSummary, 0, len(handles))
+	for _, h := range handles {
+		summaries = append(summaries, h.summary())
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].ID < summaries[j].ID
+	})
+	return summaries
+}
+
 // TaskStats returns a channel which the driver should send stats to at the given interval.
 func (d *MiloDriverPlugin) TaskStats(ctx context.Context, taskID string, interval time.Duration) (<-chan *drivers.TaskResourceUsage, error) {
 	handle, ok := d.tasks.Get(taskID)
@@ -625,6 +1221,13 @@ func (d *MiloDriverPlugin) SignalTask(taskID string, signal string) error {
 	// The given signal must be forwarded to the target taskID. If this plugin
 	// doesn't support receiving signals (capability SendSignals is set to
 	// false) you can just return nil.
+	switch signal {
+	case pauseSignal:
+		return d.PauseTask(taskID)
+	case resumeSignal:
+		return d.ResumeTask(taskID)
+	}
+
 	sig := os.Interrupt
 	if s, ok := signals.SignalLookup[signal]; ok {
 		sig = s
@@ -635,6 +1238,51 @@ func (d *MiloDriverPlugin) SignalTask(taskID string, signal string) error {
 	return handle.exec.Signal(sig)
 }
 
+// PauseTask freezes a running task by sending SIGSTOP to its process group,
+// so processes started by the task are frozen too. The task keeps its
+// resources and can be thawed again with ResumeTask.
+func (d *MiloDriverPlugin) PauseTask(taskID string) error {
+	handle, ok := d.tasks.Get(taskID)
+	if !ok {
+		return drivers.ErrTaskNotFound
+	}
+
+	if !handle.IsRunning() {
+		return fmt.Errorf("cannot pause task %q: task is not running", taskID)
+	}
+
+	if freezeSignal == nil {
+		return errors.New("pausing tasks is not supported on this platform")
+	}
+
+	if err := handle.signalGroup(freezeSignal); err != nil {
+		return fmt.Errorf("failed to pause task: %v", err)
+	}
+
+	handle.setPaused(true)
+	return nil
+}
+
+// ResumeTask thaws a task previously frozen with PauseTask by sending SIGCONT
+// to its process group.
+func (d *MiloDriverPlugin) ResumeTask(taskID string) error {
+	handle, ok := d.tasks.Get(taskID)
+	if !ok {
+		return drivers.ErrTaskNotFound
+	}
+
+	if thawSignal == nil {
+		return errors.New("resuming tasks is not supported on this platform")
+	}
+
+	if err := handle.signalGroup(thawSignal); err != nil {
+		return fmt.Errorf("failed to resume task: %v", err)
+	}
+
+	handle.setPaused(false)
+	return nil
+}
+
 // ExecTask returns the result of executing the given command inside a task.
 // This is an optional capability.
 func (d *MiloDriverPlugin) ExecTask(taskID string, cmd []string, timeout time.Duration) (*drivers.ExecTaskResult, error) {
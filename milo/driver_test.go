@@ -1,9 +1,25 @@
 package milo
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-plugin"
+	"github.com/hashicorp/nomad/client/lib/cgroupslib"
+	"github.com/hashicorp/nomad/drivers/shared/executor"
 	"github.com/hashicorp/nomad/plugins/base"
 	"github.com/hashicorp/nomad/plugins/drivers"
 	"github.com/stretchr/testify/assert"
@@ -90,4 +106,1042 @@ func TestSetConfig(t *testing.T) {
 	}
 	err = plugin.SetConfig(cfg2)
 	assert.NoError(t, err)
-}
\ No newline at end of file
+}
+func TestValidateTaskConfig(t *testing.T) {
+	cases := []struct {
+		name   string
+		cfg    TaskConfig
+		errMsg string
+	}{
+		{name: "plain greeting", cfg: TaskConfig{Greeting: "Hello, World!"}},
+		{name: "empty greeting", cfg: TaskConfig{}},
+		{name: "shell characters", cfg: TaskConfig{Greeting: "Costs $5, say \"hi\" `now`\\"}},
+		{name: "nice out of range", cfg: TaskConfig{Greeting: "hi", Nice: 20}, errMsg: "nice 20"},
+		{name: "bad success exit code", cfg: TaskConfig{Greeting: "hi", SuccessExitCodes: []int{0, 256}}, errMsg: "success exit code 256"},
+		{name: "bad liveness", cfg: TaskConfig{Greeting: "hi", Liveness: &LivenessConfig{Interval: "10s", FailureThreshold: 1}}, errMsg: "liveness command"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateTaskConfig(tc.cfg)
+			if tc.errMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.errMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestWriteTaskStderr(t *testing.T) {
+	logger := hclog.NewNullLogger()
+	d := NewPlugin(logger).(*MiloDriverPlugin)
+
+	stderrPath := filepath.Join(t.TempDir(), "stderr")
+	require.NoError(t, os.WriteFile(stderrPath, nil, 0o644))
+
+	cfg := &drivers.TaskConfig{ID: "task-id", StderrPath: stderrPath}
+	d.writeTaskStderr(cfg, errors.New("failed to launch command with executor: boom"))
+
+	out, err := os.ReadFile(stderrPath)
+	require.NoError(t, err)
+	assert.Equal(t, pluginName+": failed to launch command with executor: boom\n", string(out))
+}
+
+// mockExecutor stands in for the Nomad executor. Its process runs until it is
+// signalled or shut down, and it records every signal it receives.
+type mockExecutor struct {
+	executor.Executor
+
+	lock          sync.Mutex
+	signals       []os.Signal
+	ignoreSignals bool
+	exitCode      int
+	exitSignal    int
+	shutdownGrace time.Duration
+
+	exitOnce sync.Once
+	exited   chan struct{}
+}
+
+func newMockExecutor() *mockExecutor {
+	return &mockExecutor{exited: make(chan struct{})}
+}
+
+// exit makes the mock process exit with the given code and signal.
+func (e *mockExecutor) exit(code, signal int) {
+	e.exitOnce.Do(func() {
+		e.lock.Lock()
+		e.exitCode = code
+		e.exitSignal = signal
+		e.lock.Unlock()
+		close(e.exited)
+	})
+}
+
+func (e *mockExecutor) Wait(ctx context.Context) (*executor.ProcessState, error) {
+	select {
+	case <-e.exited:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return &executor.ProcessState{ExitCode: e.exitCode, Signal: e.exitSignal, Time: time.Now()}, nil
+}
+
+func (e *mockExecutor) Signal(sig os.Signal) error {
+	e.lock.Lock()
+	e.signals = append(e.signals, sig)
+	ignore := e.ignoreSignals
+	e.lock.Unlock()
+
+	if !ignore || sig == os.Kill {
+		e.exit(0, int(sig.(syscall.Signal)))
+	}
+	return nil
+}
+
+// Shutdown kills the mock process, unless it is given a grace period and
+// ignores signals, in which case it lingers and the executor gives up on it.
+func (e *mockExecutor) Shutdown(signal string, grace time.Duration) error {
+	e.lock.Lock()
+	e.shutdownGrace = grace
+	ignore := e.ignoreSignals
+	e.lock.Unlock()
+
+	if grace > 0 && ignore {
+		return errors.New("executor failed to shutdown error: process did not exit after 15 seconds")
+	}
+	e.exit(0, int(syscall.SIGKILL))
+	return nil
+}
+
+func (e *mockExecutor) receivedSignals() []os.Signal {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return append([]os.Signal(nil), e.signals...)
+}
+
+// startMockTask registers a running task backed by exec with the driver.
+func startMockTask(d *MiloDriverPlugin, id string, exec executor.Executor) *taskHandle {
+	h := &taskHandle{
+		exec:         exec,
+		pluginClient: &plugin.Client{},
+		taskConfig:   &drivers.TaskConfig{ID: id, Name: "milo-task", AllocID: "alloc-id"},
+		procState:    drivers.TaskStateRunning,
+		startedAt:    time.Now(),
+		logger:       d.logger,
+		eventer:      d.eventer,
+		doneCh:       make(chan struct{}),
+	}
+	d.tasks.Set(id, h)
+	go h.run()
+	return h
+}
+
+// waitForEvent returns the first event with the given annotation key,
+// skipping any other events emitted in the meantime.
+func waitForEvent(t *testing.T, events <-chan *drivers.TaskEvent, key string) *drivers.TaskEvent {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-events:
+			if _, ok := ev.Annotations[key]; ok {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for event with %q annotation", key)
+			return nil
+		}
+	}
+}
+
+func TestDestroyTask_GracePeriod(t *testing.T) {
+	cases := []struct {
+		name          string
+		ignoreSignals bool
+		forceKilled   string
+	}{
+		{name: "exits within grace", ignoreSignals: false, forceKilled: "false"},
+		{name: "force killed after grace", ignoreSignals: true, forceKilled: "true"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+			d.config.destroyGracePeriod = 200 * time.Millisecond
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			events, err := d.TaskEvents(ctx)
+			require.NoError(t, err)
+
+			exec := newMockExecutor()
+			exec.ignoreSignals = tc.ignoreSignals
+			startMockTask(d, "task-id", exec)
+
+			require.NoError(t, d.DestroyTask("task-id", true))
+			assert.Equal(t, []os.Signal{syscall.SIGTERM}, exec.receivedSignals())
+
+			ev := waitForEvent(t, events, "force_killed")
+			assert.Equal(t, "task-id", ev.TaskID)
+			assert.Equal(t, tc.forceKilled, ev.Annotations["force_killed"])
+
+			_, ok := d.tasks.Get("task-id")
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestStartFailureTracker(t *testing.T) {
+	tracker := newStartFailureTracker()
+	now := time.Now()
+
+	tracker.RecordFailure("failed to create executor: missing binary")
+	tracker.RecordFailure("failed to launch command with executor: boom")
+	unhealthy, _ := tracker.Unhealthy(3, time.Minute, now)
+	assert.False(t, unhealthy)
+
+	tracker.RecordFailure("failed to create executor: missing binary")
+	unhealthy, reason := tracker.Unhealthy(3, time.Minute, now)
+	assert.True(t, unhealthy)
+	assert.Equal(t, "failed to create executor: missing binary", reason)
+
+	// A zero threshold disables the check
+	unhealthy, _ = tracker.Unhealthy(0, time.Minute, now)
+	assert.False(t, unhealthy)
+
+	// Failures outside of the window are ignored
+	unhealthy, _ = tracker.Unhealthy(3, time.Minute, now.Add(2*time.Minute))
+	assert.False(t, unhealthy)
+}
+
+func TestBuildFingerprint_RepeatedStartFailures(t *testing.T) {
+	d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+	d.config.Shell = "bash"
+	d.config.StartFailureThreshold = 2
+	d.config.startFailureWindow = time.Minute
+
+	d.startFailures.RecordFailure("failed to create executor: missing binary")
+	d.startFailures.RecordFailure("failed to create executor: missing binary")
+
+	fp := d.buildFingerprint()
+	assert.Equal(t, drivers.HealthStateUnhealthy, fp.Health)
+	assert.Contains(t, fp.HealthDescription, "failed to create executor: missing binary")
+
+	// The start counters are still reported while unhealthy
+	assert.Contains(t, fp.Attributes, "driver.milo.starts_total")
+	assert.Contains(t, fp.Attributes, "driver.milo.starts_failed")
+
+	d.startFailures.RecordSuccess()
+
+	fp = d.buildFingerprint()
+	assert.NotEqual(t, drivers.HealthStateUnhealthy, fp.Health)
+}
+
+func TestSignalTask(t *testing.T) {
+	d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+
+	// The task handles the signals itself and keeps running
+	exec := newMockExecutor()
+	exec.ignoreSignals = true
+	h := startMockTask(d, "task-id", exec)
+
+	require.NoError(t, d.SignalTask("task-id", "SIGHUP"))
+	require.NoError(t, d.SignalTask("task-id", "NOTASIGNAL"))
+
+	assert.Equal(t, []os.Signal{syscall.SIGHUP, os.Interrupt}, exec.receivedSignals())
+	assert.True(t, h.IsRunning())
+
+	assert.ErrorIs(t, d.SignalTask("missing", "SIGHUP"), drivers.ErrTaskNotFound)
+}
+
+func TestTaskExitClassification(t *testing.T) {
+	cases := []struct {
+		name      string
+		exitCode  int
+		signal    int
+		exitClass string
+		message   string
+	}{
+		{name: "success", exitCode: 0, exitClass: exitClassSuccess, message: "Task exited successfully"},
+		{name: "application error", exitCode: 42, exitClass: exitClassApplicationError, message: "Task exited with application error code 42"},
+		{name: "killed", exitCode: 137, signal: int(syscall.SIGKILL), exitClass: exitClassSignal, message: "Task was terminated by signal SIGKILL"},
+		{name: "signal exit code only", exitCode: 143, exitClass: exitClassSignal, message: "Task was terminated by signal SIGTERM"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			events, err := d.TaskEvents(ctx)
+			require.NoError(t, err)
+
+			exec := newMockExecutor()
+			startMockTask(d, "task-id", exec)
+			exec.exit(tc.exitCode, tc.signal)
+
+			ev := waitForEvent(t, events, "exit_class")
+			assert.Equal(t, tc.exitClass, ev.Annotations["exit_class"])
+			assert.Equal(t, tc.message, ev.Message)
+		})
+	}
+}
+
+func TestSetConfig_APIVersion(t *testing.T) {
+	var configBytes []byte
+	require.NoError(t, base.MsgPackEncode(&configBytes, map[string]interface{}{"shell": "bash"}))
+
+	cases := []struct {
+		name       string
+		apiVersion string
+		warns      bool
+	}{
+		{name: "supported version", apiVersion: drivers.ApiVersion010},
+		{name: "not negotiated", apiVersion: ""},
+		{name: "unsupported version", apiVersion: "v0.0.1", warns: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := hclog.New(&hclog.LoggerOptions{Output: &buf, Level: hclog.Warn})
+			plugin := NewPlugin(logger)
+
+			err := plugin.SetConfig(&base.Config{ApiVersion: tc.apiVersion, PluginConfig: configBytes})
+			require.NoError(t, err)
+
+			if tc.warns {
+				assert.Contains(t, buf.String(), "plugin API version this driver does not support")
+				assert.Contains(t, buf.String(), tc.apiVersion)
+			} else {
+				assert.Empty(t, buf.String())
+			}
+		})
+	}
+}
+
+func TestBuildFingerprint_StartCounters(t *testing.T) {
+	d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+	d.config.Shell = "bash"
+	startMockTask(d, "task-id", newMockExecutor())
+
+	// Starting a task with an ID that is already running fails
+	for i := 0; i < 2; i++ {
+		_, _, err := d.StartTask(&drivers.TaskConfig{ID: "task-id"})
+		require.Error(t, err)
+	}
+
+	fp := d.buildFingerprint()
+	total, ok := fp.Attributes["driver.milo.starts_total"].GetInt()
+	require.True(t, ok)
+	failed, ok := fp.Attributes["driver.milo.starts_failed"].GetInt()
+	require.True(t, ok)
+	assert.Equal(t, int64(2), total)
+	assert.Equal(t, int64(2), failed)
+}
+
+func TestValidateTaskConfig_Nice(t *testing.T) {
+	if !niceSupported {
+		assert.NoError(t, ValidateTaskConfig(TaskConfig{Nice: 0}))
+		assert.ErrorContains(t, ValidateTaskConfig(TaskConfig{Nice: 10}), "not supported")
+		return
+	}
+
+	for _, nice := range []int{-20, 0, 10, 19} {
+		assert.NoError(t, ValidateTaskConfig(TaskConfig{Nice: nice}), "nice %d", nice)
+	}
+
+	for _, nice := range []int{-21, 20} {
+		err := ValidateTaskConfig(TaskConfig{Nice: nice})
+		require.Error(t, err, "nice %d", nice)
+		assert.Contains(t, err.Error(), "must be between -20 and 19")
+	}
+}
+
+func TestCheckTaskConfigAllowed_MinNice(t *testing.T) {
+	var configBytes []byte
+	require.NoError(t, base.MsgPackEncode(&configBytes, map[string]interface{}{"shell": "bash"}))
+	d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+	require.NoError(t, d.SetConfig(&base.Config{PluginConfig: configBytes}))
+
+	// By default jobs may only lower their priority
+	assert.NoError(t, d.checkTaskConfigAllowed(TaskConfig{Nice: 10}))
+	assert.NoError(t, d.checkTaskConfigAllowed(TaskConfig{}))
+	assert.ErrorContains(t, d.checkTaskConfigAllowed(TaskConfig{Nice: -5}), "below the minimum of 0")
+
+	d.config.MinNice = -10
+	assert.NoError(t, d.checkTaskConfigAllowed(TaskConfig{Nice: -5}))
+	assert.Error(t, d.checkTaskConfigAllowed(TaskConfig{Nice: -11}))
+
+	configBytes = nil
+	require.NoError(t, base.MsgPackEncode(&configBytes, map[string]interface{}{"shell": "bash", "min_nice": -21}))
+	assert.ErrorContains(t, d.SetConfig(&base.Config{PluginConfig: configBytes}), "invalid min_nice")
+}
+
+func TestBuildExecCommand(t *testing.T) {
+	d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+	d.config.Shell = "bash"
+	cfg := &drivers.TaskConfig{StdoutPath: "stdout", StderrPath: "stderr"}
+
+	execCmd := d.buildExecCommand(cfg, TaskConfig{Greeting: "hi"})
+	assert.Equal(t, "bash", execCmd.Cmd)
+	assert.Equal(t, []string{"-c", `echo "$1"`, pluginName, "hi"}, execCmd.Args)
+	assert.Equal(t, "stdout", execCmd.StdoutPath)
+	assert.Equal(t, "stderr", execCmd.StderrPath)
+
+	execCmd = d.buildExecCommand(cfg, TaskConfig{Greeting: "hi", Nice: 10})
+	assert.Equal(t, "nice", execCmd.Cmd)
+	assert.Equal(t, []string{"-n", "10", "bash", "-c", `echo "$1"`, pluginName, "hi"}, execCmd.Args)
+
+	// The greeting reaches the shell as an argument and is never evaluated
+	execCmd = d.buildExecCommand(cfg, TaskConfig{Greeting: "$(whoami)"})
+	assert.Equal(t, "$(whoami)", execCmd.Args[len(execCmd.Args)-1])
+}
+
+func TestTaskNameFromConfig(t *testing.T) {
+	d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := d.TaskEvents(ctx)
+	require.NoError(t, err)
+
+	exec := newMockExecutor()
+	h := startMockTask(d, "task-id", exec)
+	h.taskConfig.Name = "not-the-default-name"
+
+	status, err := d.InspectTask("task-id")
+	require.NoError(t, err)
+	assert.Equal(t, "not-the-default-name", status.Name)
+
+	exec.exit(0, 0)
+	ev := waitForEvent(t, events, "exit_class")
+	assert.Equal(t, "not-the-default-name", ev.TaskName)
+}
+
+func TestSuccessExitCodes(t *testing.T) {
+	cases := []struct {
+		name             string
+		successExitCodes []int
+		exitCode         int
+		successful       bool
+		exitClass        string
+	}{
+		{name: "default zero", exitCode: 0, successful: true, exitClass: exitClassSuccess},
+		{name: "default non-zero", exitCode: 2, successful: false, exitClass: exitClassApplicationError},
+		{name: "declared success code", successExitCodes: []int{0, 2}, exitCode: 2, successful: true, exitClass: exitClassSuccess},
+		{name: "undeclared zero", successExitCodes: []int{2}, exitCode: 0, successful: false, exitClass: exitClassApplicationError},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			events, err := d.TaskEvents(ctx)
+			require.NoError(t, err)
+
+			exec := newMockExecutor()
+			h := startMockTask(d, "task-id", exec)
+			h.successExitCodes = tc.successExitCodes
+
+			waitCh, err := d.WaitTask(ctx, "task-id")
+			require.NoError(t, err)
+
+			exec.exit(tc.exitCode, 0)
+
+			ev := waitForEvent(t, events, "exit_class")
+			assert.Equal(t, tc.exitClass, ev.Annotations["exit_class"])
+
+			status, err := d.InspectTask("task-id")
+			require.NoError(t, err)
+			assert.Equal(t, tc.successful, status.ExitResult.Successful())
+
+			select {
+			case result := <-waitCh:
+				assert.Equal(t, tc.successful, result.Successful())
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for exit result")
+			}
+		})
+	}
+}
+
+func TestValidateTaskConfig_SuccessExitCodes(t *testing.T) {
+	assert.NoError(t, ValidateTaskConfig(TaskConfig{SuccessExitCodes: []int{0, 2, 255}}))
+
+	err := ValidateTaskConfig(TaskConfig{SuccessExitCodes: []int{0, 256}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "success exit code 256")
+}
+
+func TestValidateTaskConfig_Liveness(t *testing.T) {
+	valid := LivenessConfig{Command: []string{"true"}, Interval: "10s", FailureThreshold: 3}
+	assert.NoError(t, ValidateTaskConfig(TaskConfig{Liveness: &valid}))
+
+	cases := []struct {
+		name     string
+		liveness LivenessConfig
+		errMsg   string
+	}{
+		{name: "no command", liveness: LivenessConfig{Interval: "10s", FailureThreshold: 3}, errMsg: "command must not be empty"},
+		{name: "bad interval", liveness: LivenessConfig{Command: []string{"true"}, Interval: "often", FailureThreshold: 3}, errMsg: "invalid liveness interval"},
+		{name: "zero interval", liveness: LivenessConfig{Command: []string{"true"}, Interval: "0s", FailureThreshold: 3}, errMsg: "must be positive"},
+		{name: "zero threshold", liveness: LivenessConfig{Command: []string{"true"}, Interval: "10s"}, errMsg: "must be at least 1"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateTaskConfig(TaskConfig{Liveness: &tc.liveness})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.errMsg)
+		})
+	}
+}
+
+func TestWatchLiveness(t *testing.T) {
+	d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := d.TaskEvents(ctx)
+	require.NoError(t, err)
+
+	exec := newMockExecutor()
+	h := startMockTask(d, "task-id", exec)
+	h.taskConfig.AllocDir = t.TempDir()
+	h.taskConfig.Env = map[string]string{"PROBE_FILE": "probes"}
+	require.NoError(t, os.MkdirAll(h.taskConfig.TaskDir().Dir, 0o755))
+
+	// The probe runs in the task directory with the task's environment,
+	// passes twice and fails from then on
+	go d.watchLiveness(h, &LivenessConfig{
+		Command:          []string{"sh", "-c", `echo >> "$PROBE_FILE"; test "$(wc -l < "$PROBE_FILE")" -le 2`},
+		Interval:         "10ms",
+		FailureThreshold: 2,
+	})
+
+	ev := waitForEvent(t, events, "liveness_failures")
+	assert.Equal(t, "2", ev.Annotations["liveness_failures"])
+
+	select {
+	case <-h.doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("task was not stopped after liveness failures")
+	}
+	assert.False(t, h.IsRunning())
+
+	probes, err := os.ReadFile(filepath.Join(h.taskConfig.TaskDir().Dir, "probes"))
+	require.NoError(t, err)
+	assert.Equal(t, 4, strings.Count(string(probes), "\n"))
+}
+
+func TestStartTask_LivenessNotAllowed(t *testing.T) {
+	d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+	d.config.Shell = "bash"
+
+	cfg := &drivers.TaskConfig{ID: "task-id", AllocDir: t.TempDir(), Name: "milo-task"}
+	require.NoError(t, cfg.EncodeConcreteDriverConfig(&TaskConfig{
+		Greeting: "hi",
+		Liveness: &LivenessConfig{Command: []string{"true"}, Interval: "10s", FailureThreshold: 3},
+	}))
+
+	// Probes run commands from the job on the node, so the operator has to
+	// allow them first
+	_, _, err := d.StartTask(cfg)
+	require.ErrorContains(t, err, "liveness probes are not allowed")
+}
+
+func TestStopTask_Verification(t *testing.T) {
+	cases := []struct {
+		name          string
+		ignoreSignals bool
+		verifyTimeout time.Duration
+		forceKilled   bool
+		expectedErr   bool
+	}{
+		{name: "exits on stop", ignoreSignals: false, verifyTimeout: 100 * time.Millisecond},
+		{name: "lingers after stop", ignoreSignals: true, verifyTimeout: 100 * time.Millisecond, forceKilled: true},
+		{name: "lingers without verification", ignoreSignals: true, verifyTimeout: 0, expectedErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+			d.config.stopVerifyTimeout = tc.verifyTimeout
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			events, err := d.TaskEvents(ctx)
+			require.NoError(t, err)
+
+			exec := newMockExecutor()
+			exec.ignoreSignals = tc.ignoreSignals
+			h := startMockTask(d, "task-id", exec)
+
+			err = d.StopTask("task-id", time.Second, "SIGTERM")
+			if tc.expectedErr {
+				require.ErrorContains(t, err, "executor Shutdown failed")
+				assert.True(t, h.IsRunning())
+				assert.NotContains(t, exec.receivedSignals(), os.Kill)
+				return
+			}
+			require.NoError(t, err)
+			<-h.doneCh
+			assert.False(t, h.IsRunning())
+
+			if tc.forceKilled {
+				assert.Equal(t, []os.Signal{os.Kill}, exec.receivedSignals())
+				ev := waitForEvent(t, events, "force_killed")
+				assert.Equal(t, "true", ev.Annotations["force_killed"])
+			}
+		})
+	}
+}
+
+func TestInspectTask_DriverAttributes(t *testing.T) {
+	d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+	h := startMockTask(d, "task-id", newMockExecutor())
+	h.pid = 4242
+	h.taskConfig.Resources = &drivers.Resources{
+		LinuxResources: &drivers.LinuxResources{
+			MemoryLimitBytes: 256 * 1024 * 1024,
+			CPUShares:        500,
+		},
+	}
+
+	status, err := d.InspectTask("task-id")
+	require.NoError(t, err)
+
+	attrs := status.DriverAttributes
+	assert.Equal(t, "4242", attrs["pid"])
+	assert.Equal(t, "false", attrs["paused"])
+	assert.Equal(t, h.startedAt.Format(time.RFC3339), attrs["started_at"])
+	assert.Equal(t, "268435456", attrs["memory_limit_bytes"])
+	assert.Equal(t, "500", attrs["cpu_shares"])
+}
+
+func TestBuildFingerprint_CgroupVersion(t *testing.T) {
+	if cgroupslib.GetMode() == cgroupslib.OFF {
+		t.Skip("cgroups are not enabled on this host")
+	}
+
+	d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+	d.config.Shell = "bash"
+
+	// cgroup v2 exposes the available controllers at the root of the
+	// unified hierarchy
+	expected := "1"
+	if _, err := os.Stat("/sys/fs/cgroup/cgroup.controllers"); err == nil {
+		expected = "2"
+	}
+
+	fp := d.buildFingerprint()
+	version, ok := fp.Attributes["driver.milo.cgroup_version"].GetString()
+	require.True(t, ok)
+	assert.Equal(t, expected, version)
+}
+
+func TestStopTask_MinStopTimeout(t *testing.T) {
+	cases := []struct {
+		name     string
+		minimum  time.Duration
+		timeout  time.Duration
+		expected time.Duration
+	}{
+		{name: "no minimum", minimum: 0, timeout: 0, expected: 0},
+		{name: "zero raised to minimum", minimum: 2 * time.Second, timeout: 0, expected: 2 * time.Second},
+		{name: "longer timeout kept", minimum: 2 * time.Second, timeout: 10 * time.Second, expected: 10 * time.Second},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+			d.config.minStopTimeout = tc.minimum
+
+			exec := newMockExecutor()
+			startMockTask(d, "task-id", exec)
+
+			require.NoError(t, d.StopTask("task-id", tc.timeout, "SIGTERM"))
+
+			exec.lock.Lock()
+			defer exec.lock.Unlock()
+			assert.Equal(t, tc.expected, exec.shutdownGrace)
+		})
+	}
+}
+
+func TestListTasks(t *testing.T) {
+	d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+	require.Empty(t, d.ListTasks())
+
+	second := startMockTask(d, "task-b", newMockExecutor())
+	second.pid = 2
+	first := startMockTask(d, "task-a", newMockExecutor())
+	first.pid = 1
+
+	tasks := d.ListTasks()
+	require.Len(t, tasks, 2)
+	assert.Equal(t, "task-a", tasks[0].ID)
+	assert.Equal(t, 1, tasks[0].PID)
+	assert.Equal(t, drivers.TaskStateRunning, tasks[0].State)
+	assert.Equal(t, "task-b", tasks[1].ID)
+	assert.Equal(t, 2, tasks[1].PID)
+
+	require.NoError(t, d.StopTask("task-a", 0, "SIGTERM"))
+	<-first.doneCh
+	require.NoError(t, d.DestroyTask("task-a", false))
+
+	tasks = d.ListTasks()
+	require.Len(t, tasks, 1)
+	assert.Equal(t, "task-b", tasks[0].ID)
+}
+
+func TestStopTask_ExitClassifiedAsStopped(t *testing.T) {
+	d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := d.TaskEvents(ctx)
+	require.NoError(t, err)
+
+	exec := newMockExecutor()
+	h := startMockTask(d, "task-id", exec)
+	h.successExitCodes = []int{0}
+
+	require.NoError(t, d.StopTask("task-id", 0, "SIGTERM"))
+
+	ev := waitForEvent(t, events, "exit_class")
+	assert.Equal(t, exitClassStopped, ev.Annotations["exit_class"])
+	assert.Equal(t, "Task was stopped by the driver", ev.Message)
+
+	// An exit code outside of the success exit codes is not an error once
+	// the driver asked the task to stop
+	result := h.newExitResult(&executor.ProcessState{ExitCode: 143})
+	assert.Equal(t, 143, result.ExitCode)
+	assert.NoError(t, result.Err)
+}
+
+func TestCheckFreeDisk(t *testing.T) {
+	cases := []struct {
+		name        string
+		minFreeDisk int64
+		expectedErr string
+	}{
+		{name: "disabled", minFreeDisk: 0},
+		{name: "enough space", minFreeDisk: 1},
+		{name: "insufficient space", minFreeDisk: 1 << 62, expectedErr: "insufficient disk space"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+			d.config.MinFreeDisk = tc.minFreeDisk
+
+			err := d.checkFreeDisk(t.TempDir())
+			if tc.expectedErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestSetConfig_InvalidStopSignalSequence(t *testing.T) {
+	var configBytes []byte
+	require.NoError(t, base.MsgPackEncode(&configBytes, map[string]interface{}{
+		"shell":                "bash",
+		"stop_signal_sequence": []string{"SIGUSR1", "SIGNOPE"},
+	}))
+
+	d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+	err := d.SetConfig(&base.Config{PluginConfig: configBytes})
+	require.ErrorContains(t, err, `unknown signal "SIGNOPE"`)
+}
+
+func TestSetConfig_StopSignalInterval(t *testing.T) {
+	var configBytes []byte
+	require.NoError(t, base.MsgPackEncode(&configBytes, map[string]interface{}{
+		"shell":                "bash",
+		"stop_signal_sequence": []string{"SIGUSR1"},
+		"stop_signal_interval": "0s",
+	}))
+
+	d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+	err := d.SetConfig(&base.Config{PluginConfig: configBytes})
+	require.ErrorContains(t, err, "must be positive")
+}
+
+func TestWriteStartSummary(t *testing.T) {
+	d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+	dir := t.TempDir()
+	d.config.Shell = "bash"
+	d.config.StartSummaryPath = filepath.Join(dir, "${NOMAD_ALLOC_ID}", "summary.json")
+
+	cfg := &drivers.TaskConfig{
+		ID:      "task-id",
+		AllocID: "alloc-id",
+		Name:    "milo-task",
+		// A job can override NOMAD_* variables in its environment, so the
+		// path must not be expanded from it
+		Env: map[string]string{"NOMAD_ALLOC_ID": "../../escape", "SECRET_TOKEN": "hunter2"},
+		Resources: &drivers.Resources{
+			LinuxResources: &drivers.LinuxResources{MemoryLimitBytes: 268435456, CPUShares: 500},
+		},
+	}
+	execCmd := d.buildExecCommand(cfg, TaskConfig{Greeting: "hello"})
+	h := &taskHandle{pid: 4242, startedAt: time.Now().Round(time.Second), attempt: 3}
+
+	require.NoError(t, d.writeStartSummary(cfg, execCmd, h))
+
+	out, err := os.ReadFile(filepath.Join(dir, "alloc-id", "summary.json"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(out), "hunter2")
+
+	var summary startSummary
+	require.NoError(t, json.Unmarshal(out, &summary))
+	assert.Equal(t, "task-id", summary.TaskID)
+	assert.Equal(t, "alloc-id", summary.AllocID)
+	assert.Equal(t, "milo-task", summary.TaskName)
+	assert.Equal(t, 4242, summary.PID)
+	assert.Equal(t, "bash", summary.Command)
+	assert.Equal(t, []string{"-c", `echo "$1"`, pluginName, "hello"}, summary.Args)
+	assert.True(t, h.startedAt.Equal(summary.StartedAt))
+	assert.Equal(t, 3, summary.Attempt)
+	assert.Equal(t, int64(268435456), summary.MemoryLimitBytes)
+	assert.Equal(t, int64(500), summary.CPUShares)
+}
+
+func TestValidateExecCommandSize(t *testing.T) {
+	cases := []struct {
+		name        string
+		args        []string
+		expectedErr string
+	}{
+		{name: "small", args: []string{"-c", `echo "hello"`}},
+		{name: "oversized argument", args: []string{"-c", strings.Repeat("a", maxArgLen)}, expectedErr: "allowed for a single argument"},
+		{name: "oversized total", args: slices.Repeat([]string{strings.Repeat("a", maxArgLen/2)}, 40), expectedErr: "allowed for all arguments"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateExecCommandSize(&executor.ExecCommand{Cmd: "bash", Args: tc.args})
+			if tc.expectedErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestInspectTask_Uptime(t *testing.T) {
+	d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+	exec := newMockExecutor()
+	h := startMockTask(d, "task-id", exec)
+
+	uptime := func() float64 {
+		status, err := d.InspectTask("task-id")
+		require.NoError(t, err)
+		seconds, err := strconv.ParseFloat(status.DriverAttributes["driver.milo.task_uptime_seconds"], 64)
+		require.NoError(t, err)
+		return seconds
+	}
+
+	first := uptime()
+	time.Sleep(20 * time.Millisecond)
+	second := uptime()
+	assert.Greater(t, second, first)
+
+	// Once the task has exited its uptime no longer changes
+	exec.exit(0, 0)
+	<-h.doneCh
+	first = uptime()
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, first, uptime())
+}
+
+func TestInspectTask_RestartCount(t *testing.T) {
+	d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+
+	// Every restart of a task is started with a new task ID
+	for i, id := range []string{"task-1", "task-2", "task-3"} {
+		h := startMockTask(d, id, newMockExecutor())
+		h.attempt = d.startAttempts.Record(h.taskConfig.AllocID, h.taskConfig.Name)
+
+		status, err := d.InspectTask(id)
+		require.NoError(t, err)
+		assert.Equal(t, strconv.Itoa(i), status.DriverAttributes["driver.milo.task_restart_count"])
+	}
+
+	// Other tasks and allocations are counted separately, and a recovered
+	// task keeps its place in the count
+	assert.Equal(t, 1, d.startAttempts.Record("alloc-id", "other-task"))
+	d.startAttempts.Restore("other-alloc", "milo-task", 5)
+	assert.Equal(t, 6, d.startAttempts.Record("other-alloc", "milo-task"))
+	d.startAttempts.Restore("alloc-id", "milo-task", 1)
+	assert.Equal(t, 4, d.startAttempts.Record("alloc-id", "milo-task"))
+}
+
+func TestEmitStartEvent(t *testing.T) {
+	d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := d.TaskEvents(ctx)
+	require.NoError(t, err)
+
+	h := startMockTask(d, "task-id", newMockExecutor())
+	h.attempt = 2
+	h.emitStartEvent()
+
+	ev := waitForEvent(t, events, "attempt")
+	assert.Equal(t, "2", ev.Annotations["attempt"])
+	assert.Equal(t, "alloc-id", ev.AllocID)
+	assert.Contains(t, ev.Message, "attempt 2")
+}
+
+func TestStopAndDestroyTask_Concurrent(t *testing.T) {
+	d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+	d.config.destroyGracePeriod = 100 * time.Millisecond
+	d.config.stopVerifyTimeout = 100 * time.Millisecond
+
+	// Simulate a task group being torn down after its leader exited, with
+	// Nomad stopping and destroying each task at the same time
+	var handles []*taskHandle
+	for i := 0; i < 10; i++ {
+		handles = append(handles, startMockTask(d, fmt.Sprintf("task-%d", i), newMockExecutor()))
+	}
+
+	var wg sync.WaitGroup
+	for _, h := range handles {
+		id := h.taskConfig.ID
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			err := d.StopTask(id, time.Second, "SIGTERM")
+			if err != nil {
+				assert.ErrorIs(t, err, drivers.ErrTaskNotFound)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, d.DestroyTask(id, true))
+		}()
+	}
+	wg.Wait()
+
+	for _, h := range handles {
+		<-h.doneCh
+		assert.False(t, h.IsRunning())
+		_, ok := d.tasks.Get(h.taskConfig.ID)
+		assert.False(t, ok)
+	}
+	assert.Empty(t, d.ListTasks())
+}
+
+func TestWatchLiveness_ExitClass(t *testing.T) {
+	d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := d.TaskEvents(ctx)
+	require.NoError(t, err)
+
+	exec := newMockExecutor()
+	h := startMockTask(d, "task-id", exec)
+	h.taskConfig.AllocDir = t.TempDir()
+	require.NoError(t, os.MkdirAll(h.taskConfig.TaskDir().Dir, 0o755))
+
+	go d.watchLiveness(h, &LivenessConfig{
+		Command:          []string{"false"},
+		Interval:         "10ms",
+		FailureThreshold: 2,
+	})
+
+	select {
+	case <-h.doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("task was not stopped after liveness failures")
+	}
+
+	// The exit is reported as a liveness failure, not as a stop requested
+	// by Nomad
+	ev := waitForEvent(t, events, "exit_class")
+	assert.Equal(t, exitClassLivenessFailure, ev.Annotations["exit_class"])
+	assert.False(t, h.stopRequested.Load())
+
+	h.successExitCodes = []int{0}
+	result := h.newExitResult(&executor.ProcessState{ExitCode: 143})
+	assert.Error(t, result.Err)
+}
+
+func TestStartSummaryPath(t *testing.T) {
+	cases := []struct {
+		name        string
+		path        string
+		allocID     string
+		expected    string
+		expectedErr string
+	}{
+		{name: "alloc file", path: "/var/lib/milo/${NOMAD_ALLOC_ID}-${NOMAD_TASK_NAME}.json", allocID: "alloc-id", expected: "/var/lib/milo/alloc-id-milo-task.json"},
+		{name: "alloc directory", path: "/var/lib/milo/${NOMAD_ALLOC_ID}/summary.json", allocID: "alloc-id", expected: "/var/lib/milo/alloc-id/summary.json"},
+		{name: "escapes root", path: "/var/lib/milo/${NOMAD_ALLOC_ID}/summary.json", allocID: "../../../etc", expectedErr: "is outside of /var/lib/milo"},
+		{name: "replaces root", path: "/var/lib/milo/${NOMAD_ALLOC_ID}", allocID: "..", expectedErr: "is outside of /var/lib/milo"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+			d.config.StartSummaryPath = tc.path
+
+			path, err := d.startSummaryPath(&drivers.TaskConfig{AllocID: tc.allocID, Name: "milo-task"})
+			if tc.expectedErr != "" {
+				require.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, path)
+		})
+	}
+}
+
+func TestSetConfig_StartSummaryPath(t *testing.T) {
+	cases := []struct {
+		name        string
+		path        string
+		expectedErr string
+	}{
+		{name: "valid", path: "/var/lib/milo/${NOMAD_ALLOC_ID}.json"},
+		{name: "relative", path: "milo/${NOMAD_ALLOC_ID}.json", expectedErr: "must be an absolute path"},
+		{name: "unsupported variable", path: "/var/lib/milo/${HOME}.json", expectedErr: "unsupported variables HOME"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var configBytes []byte
+			require.NoError(t, base.MsgPackEncode(&configBytes, map[string]interface{}{
+				"shell":              "bash",
+				"start_summary_path": tc.path,
+			}))
+
+			d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+			err := d.SetConfig(&base.Config{PluginConfig: configBytes})
+			if tc.expectedErr != "" {
+				require.ErrorContains(t, err, tc.expectedErr)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
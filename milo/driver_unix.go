@@ -0,0 +1,105 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !windows
+
+package milo
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// niceSupported is true as tasks can be started through nice(1) to change
+// their scheduling priority
+const niceSupported = true
+
+var (
+	// freezeSignal and thawSignal stop and continue the process of a task
+	// for PauseTask and ResumeTask
+	freezeSignal os.Signal = syscall.SIGSTOP
+	thawSignal   os.Signal = syscall.SIGCONT
+)
+
+// signalProcessGroup sends sig to every process in the process group led by
+// pid. The executor starts each task in a process group of its own, so this
+// reaches the processes the task started as well.
+func signalProcessGroup(pid int, sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return fmt.Errorf("unsupported signal %v", sig)
+	}
+	return syscall.Kill(-pid, s)
+}
+
+// processStopped reports whether the process with the given pid is stopped
+// by a signal. It reads the process state from /proc, and returns false
+// where that is not available.
+func processStopped(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+
+	// The state follows the command name, which is in parentheses and may
+	// itself contain spaces and parentheses
+	i := strings.LastIndexByte(string(stat), ')')
+	if i < 0 {
+		return false
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	return len(fields) > 0 && fields[0] == "T"
+}
+
+// freeDiskSpace returns the number of bytes available to unprivileged users
+// on the filesystem holding dir.
+func freeDiskSpace(dir string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
+
+// setCommandUser makes cmd run as the named user, if one is given.
+func setCommandUser(cmd *exec.Cmd, username string) error {
+	if username == "" {
+		return nil
+	}
+
+	u, err := user.Lookup(username)
+	if err != nil {
+		return fmt.Errorf("failed to look up user %q: %v", username, err)
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid uid %q of user %q: %v", u.Uid, username, err)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid gid %q of user %q: %v", u.Gid, username, err)
+	}
+
+	var groups []uint32
+	groupIDs, err := u.GroupIds()
+	if err != nil {
+		return fmt.Errorf("failed to look up groups of user %q: %v", username, err)
+	}
+	for _, id := range groupIDs {
+		g, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid group id %q of user %q: %v", id, username, err)
+		}
+		groups = append(groups, uint32(g))
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid), Groups: groups},
+	}
+	return nil
+}
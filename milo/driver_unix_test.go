@@ -0,0 +1,218 @@
+//go:build !windows
+
+package milo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/nomad/plugins/base"
+	"github.com/hashicorp/nomad/plugins/drivers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPauseResumeTask(t *testing.T) {
+	d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+
+	exec := newMockExecutor()
+	exec.ignoreSignals = true
+	startMockTask(d, "task-id", exec)
+
+	require.NoError(t, d.PauseTask("task-id"))
+	status, err := d.InspectTask("task-id")
+	require.NoError(t, err)
+	assert.Equal(t, "true", status.DriverAttributes["paused"])
+	assert.Equal(t, drivers.TaskStateRunning, status.State)
+
+	require.NoError(t, d.SignalTask("task-id", resumeSignal))
+	status, err = d.InspectTask("task-id")
+	require.NoError(t, err)
+	assert.Equal(t, "false", status.DriverAttributes["paused"])
+
+	require.NoError(t, d.SignalTask("task-id", pauseSignal))
+	assert.Equal(t, []os.Signal{syscall.SIGSTOP, syscall.SIGCONT, syscall.SIGSTOP}, exec.receivedSignals())
+
+	assert.ErrorIs(t, d.PauseTask("missing"), drivers.ErrTaskNotFound)
+}
+
+func TestDestroyTask_Paused(t *testing.T) {
+	d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+	d.config.destroyGracePeriod = 100 * time.Millisecond
+
+	exec := newMockExecutor()
+	exec.ignoreSignals = true
+	h := startMockTask(d, "task-id", exec)
+	require.NoError(t, d.PauseTask("task-id"))
+
+	// The task is resumed before it is asked to stop, so it can act on SIGTERM
+	require.NoError(t, d.DestroyTask("task-id", true))
+	assert.Equal(t, []os.Signal{syscall.SIGSTOP, syscall.SIGCONT, syscall.SIGTERM}, exec.receivedSignals()[:3])
+	assert.False(t, h.IsPaused())
+}
+
+func TestSignalProcessGroup(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("/proc is not available")
+	}
+
+	// The child sleeps in the background, so it only stops if the whole
+	// process group is signalled
+	cmd := osexec.Command("sh", "-c", "sleep 30 & echo $!; wait")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	out, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+	defer func() {
+		_ = signalProcessGroup(cmd.Process.Pid, syscall.SIGKILL)
+		_ = cmd.Wait()
+	}()
+
+	var child int
+	_, err = fmt.Fscan(out, &child)
+	require.NoError(t, err)
+
+	require.NoError(t, signalProcessGroup(cmd.Process.Pid, syscall.SIGSTOP))
+	require.Eventually(t, func() bool {
+		return processStopped(cmd.Process.Pid) && processStopped(child)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, signalProcessGroup(cmd.Process.Pid, syscall.SIGCONT))
+	require.Eventually(t, func() bool {
+		return !processStopped(cmd.Process.Pid) && !processStopped(child)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestStopTask_StopSignalSequence(t *testing.T) {
+	cases := []struct {
+		name          string
+		sequence      []string
+		timeout       time.Duration
+		ignoreSignals bool
+		expected      []os.Signal
+		minElapsed    time.Duration
+	}{
+		{
+			name:          "full sequence",
+			sequence:      []string{"SIGUSR1", "SIGUSR2"},
+			timeout:       time.Second,
+			ignoreSignals: true,
+			expected:      []os.Signal{syscall.SIGUSR1, syscall.SIGUSR2, os.Kill},
+			minElapsed:    100 * time.Millisecond,
+		},
+		{
+			name:          "exits during sequence",
+			sequence:      []string{"SIGUSR1", "SIGUSR2"},
+			timeout:       time.Second,
+			ignoreSignals: false,
+			expected:      []os.Signal{syscall.SIGUSR1},
+		},
+		{
+			name:          "sequence ends with stop signal",
+			sequence:      []string{"SIGUSR1", "SIGTERM"},
+			timeout:       300 * time.Millisecond,
+			ignoreSignals: true,
+			expected:      []os.Signal{syscall.SIGUSR1, syscall.SIGTERM},
+			minElapsed:    300 * time.Millisecond,
+		},
+		{
+			name:          "no time for the sequence",
+			sequence:      []string{"SIGUSR1", "SIGUSR2"},
+			timeout:       0,
+			ignoreSignals: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var configBytes []byte
+			require.NoError(t, base.MsgPackEncode(&configBytes, map[string]interface{}{
+				"shell":                "bash",
+				"stop_signal_sequence": tc.sequence,
+				"stop_signal_interval": "50ms",
+				"stop_verify_timeout":  "50ms",
+			}))
+
+			d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+			require.NoError(t, d.SetConfig(&base.Config{PluginConfig: configBytes}))
+
+			exec := newMockExecutor()
+			exec.ignoreSignals = tc.ignoreSignals
+			h := startMockTask(d, "task-id", exec)
+
+			start := time.Now()
+			require.NoError(t, d.StopTask("task-id", tc.timeout, "SIGTERM"))
+			<-h.doneCh
+			elapsed := time.Since(start)
+
+			if tc.expected == nil {
+				assert.Empty(t, exec.receivedSignals())
+			} else {
+				assert.Equal(t, tc.expected, exec.receivedSignals())
+			}
+			assert.GreaterOrEqual(t, elapsed, tc.minElapsed)
+
+			// The time spent on the sequence is taken out of the timeout
+			// left to the executor
+			exec.lock.Lock()
+			defer exec.lock.Unlock()
+			assert.LessOrEqual(t, exec.shutdownGrace, tc.timeout-tc.minElapsed)
+		})
+	}
+}
+
+func TestWatchLiveness_Paused(t *testing.T) {
+	d := NewPlugin(hclog.NewNullLogger()).(*MiloDriverPlugin)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := d.TaskEvents(ctx)
+	require.NoError(t, err)
+
+	exec := newMockExecutor()
+	exec.ignoreSignals = true
+	h := startMockTask(d, "task-id", exec)
+	h.taskConfig.AllocDir = t.TempDir()
+	require.NoError(t, os.MkdirAll(h.taskConfig.TaskDir().Dir, 0o755))
+	require.NoError(t, d.PauseTask("task-id"))
+
+	go d.watchLiveness(h, &LivenessConfig{
+		Command:          []string{"false"},
+		Interval:         "10ms",
+		FailureThreshold: 2,
+	})
+
+	// The probe would fail, but the task is paused and must not be stopped
+	select {
+	case <-h.doneCh:
+		t.Fatal("paused task was stopped by its liveness probe")
+	case <-time.After(200 * time.Millisecond):
+	}
+	assert.True(t, h.IsRunning())
+	assert.True(t, h.IsPaused())
+
+	// Once resumed, the failing probe stops the task again
+	require.NoError(t, d.ResumeTask("task-id"))
+	ev := waitForEvent(t, events, "liveness_failures")
+	assert.Equal(t, "2", ev.Annotations["liveness_failures"])
+}
+
+func TestSetCommandUser(t *testing.T) {
+	cmd := osexec.Command("true")
+	require.NoError(t, setCommandUser(cmd, ""))
+	assert.Nil(t, cmd.SysProcAttr)
+
+	require.NoError(t, setCommandUser(cmd, "root"))
+	require.NotNil(t, cmd.SysProcAttr)
+	require.NotNil(t, cmd.SysProcAttr.Credential)
+	assert.Equal(t, uint32(0), cmd.SysProcAttr.Credential.Uid)
+	assert.Equal(t, uint32(0), cmd.SysProcAttr.Credential.Gid)
+
+	assert.Error(t, setCommandUser(osexec.Command("true"), "no-such-milo-user"))
+}
@@ -0,0 +1,57 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package milo
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"golang.org/x/sys/windows"
+)
+
+// niceSupported is false as Windows has no nice(1) to start tasks with a
+// different scheduling priority
+const niceSupported = false
+
+var (
+	// Windows has no signals to stop and continue a process with, so tasks
+	// cannot be paused
+	freezeSignal os.Signal
+	thawSignal   os.Signal
+)
+
+// signalProcessGroup fails, as Windows has no process groups to signal.
+func signalProcessGroup(pid int, sig os.Signal) error {
+	return fmt.Errorf("signalling process groups is not supported on Windows")
+}
+
+// processStopped always returns false, as tasks cannot be paused on Windows.
+func processStopped(pid int) bool {
+	return false
+}
+
+// freeDiskSpace returns the number of bytes available to the agent's user
+// on the volume holding dir.
+func freeDiskSpace(dir string) (int64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &free, nil, nil); err != nil {
+		return 0, err
+	}
+	return int64(free), nil
+}
+
+// setCommandUser fails for any user, as commands cannot be run as another
+// user on Windows.
+func setCommandUser(cmd *exec.Cmd, username string) error {
+	if username == "" {
+		return nil
+	}
+	return fmt.Errorf("running commands as user %q is not supported on Windows", username)
+}
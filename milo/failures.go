@@ -0,0 +1,72 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package milo
+
+import (
+	"sync"
+	"time"
+)
+
+// startFailureTracker records recent task start failures so that the driver
+// can report itself unhealthy when tasks keep failing to start for the same
+// reason, instead of accepting more allocations.
+type startFailureTracker struct {
+	failures []startFailure
+	lock     sync.Mutex
+}
+
+type startFailure struct {
+	at     time.Time
+	reason string
+}
+
+func newStartFailureTracker() *startFailureTracker {
+	return &startFailureTracker{}
+}
+
+// RecordFailure records a failed task start with the given reason.
+func (t *startFailureTracker) RecordFailure(reason string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.failures = append(t.failures, startFailure{at: time.Now(), reason: reason})
+}
+
+// RecordSuccess forgets all previous failures, since a successful start shows
+// that the driver is able to run tasks again.
+func (t *startFailureTracker) RecordSuccess() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.failures = nil
+}
+
+// Unhealthy returns true if at least threshold failures were recorded within
+// the window before now, along with the most frequent failure reason among
+// them. A threshold of zero or less disables the check.
+func (t *startFailureTracker) Unhealthy(threshold int, window time.Duration, now time.Time) (bool, string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// Drop failures that have aged out of the window
+	recent := t.failures[:0]
+	for _, f := range t.failures {
+		if now.Sub(f.at) <= window {
+			recent = append(recent, f)
+		}
+	}
+	t.failures = recent
+
+	if threshold <= 0 || len(recent) < threshold {
+		return false, ""
+	}
+
+	counts := map[string]int{}
+	dominant := ""
+	for _, f := range recent {
+		counts[f.reason]++
+		if counts[f.reason] > counts[dominant] {
+			dominant = f.reason
+		}
+	}
+	return true, dominant
+}
@@ -5,16 +5,35 @@ package milo
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/hashicorp/consul-template/signals"
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-plugin"
+	"github.com/hashicorp/nomad/drivers/shared/eventer"
 	"github.com/hashicorp/nomad/drivers/shared/executor"
 	"github.com/hashicorp/nomad/plugins/drivers"
 )
 
+const (
+	// Exit classes reported in the exit_class annotation of the event
+	// emitted when a task exits
+	exitClassSuccess          = "success"
+	exitClassApplicationError = "application-error"
+	exitClassSignal           = "signal"
+	exitClassInfraError       = "infra-error"
+	exitClassStopped          = "stopped"
+	exitClassLivenessFailure  = "liveness-failure"
+)
+
 // taskHandle should store all relevant runtime information
 // such as process ID if this is a local task or other meta
 // data if this driver deals with external APIs
@@ -23,6 +42,7 @@ type taskHandle struct {
 	stateLock sync.RWMutex
 
 	logger       hclog.Logger
+	eventer      *eventer.Eventer
 	exec         executor.Executor
 	pluginClient *plugin.Client
 	taskConfig   *drivers.TaskConfig
@@ -31,6 +51,28 @@ type taskHandle struct {
 	completedAt  time.Time
 	exitResult   *drivers.ExitResult
 
+	// paused is true while the task is frozen by PauseTask
+	paused bool
+
+	// attempt is how many times the task has been started in its
+	// allocation, so attempt-1 is its restart count
+	attempt int
+
+	// successExitCodes are the exit codes that count as success instead of
+	// just 0, set from the task config
+	successExitCodes []int
+
+	// stopRequested is set once the driver has asked the task to stop, so
+	// that the resulting exit is not reported as a crash
+	stopRequested atomic.Bool
+
+	// livenessFailed is set when the driver stops the task because it
+	// failed its liveness probe
+	livenessFailed atomic.Bool
+
+	// doneCh is closed once the task has exited and its state is updated
+	doneCh chan struct{}
+
 	// TODO: add any extra relevant information about the task.
 	pid int
 }
@@ -39,16 +81,49 @@ func (h *taskHandle) TaskStatus() *drivers.TaskStatus {
 	h.stateLock.RLock()
 	defer h.stateLock.RUnlock()
 
+	attrs := map[string]string{
+		"pid":        strconv.Itoa(h.pid),
+		"paused":     strconv.FormatBool(h.paused),
+		"started_at": h.startedAt.Format(time.RFC3339),
+	}
+
+	// Uptime stops counting once the task has exited
+	end := time.Now()
+	if !h.completedAt.IsZero() {
+		end = h.completedAt
+	}
+	attrs["driver.milo.task_uptime_seconds"] = strconv.FormatFloat(end.Sub(h.startedAt).Seconds(), 'f', 3, 64)
+	if h.attempt > 0 {
+		attrs["driver.milo.task_restart_count"] = strconv.Itoa(h.attempt - 1)
+	}
+
+	// Expose the resource limits the task was started with so monitoring
+	// can compare them against usage without querying Nomad
+	if res := h.taskConfig.Resources; res != nil && res.LinuxResources != nil {
+		attrs["memory_limit_bytes"] = strconv.FormatInt(res.LinuxResources.MemoryLimitBytes, 10)
+		attrs["cpu_shares"] = strconv.FormatInt(res.LinuxResources.CPUShares, 10)
+	}
+
 	return &drivers.TaskStatus{
-		ID:          h.taskConfig.ID,
-		Name:        h.taskConfig.Name,
-		State:       h.procState,
-		StartedAt:   h.startedAt,
-		CompletedAt: h.completedAt,
-		ExitResult:  h.exitResult,
-		DriverAttributes: map[string]string{
-			"pid": strconv.Itoa(h.pid),
-		},
+		ID:               h.taskConfig.ID,
+		Name:             h.taskConfig.Name,
+		State:            h.procState,
+		StartedAt:        h.startedAt,
+		CompletedAt:      h.completedAt,
+		ExitResult:       h.exitResult,
+		DriverAttributes: attrs,
+	}
+}
+
+func (h *taskHandle) summary() TaskSummary {
+	h.stateLock.RLock()
+	defer h.stateLock.RUnlock()
+	return TaskSummary{
+		ID:        h.taskConfig.ID,
+		PID:       h.pid,
+		StartedAt: h.startedAt,
+		State:     h.procState,
+		Paused:    h.paused,
 	}
 }
 
@@ -58,6 +133,28 @@ func (h *taskHandle) IsRunning() bool {
 	return h.procState == drivers.TaskStateRunning
 }
 
+func (h *taskHandle) IsPaused() bool {
+	h.stateLock.RLock()
+	defer h.stateLock.RUnlock()
+	return h.paused
+}
+
+func (h *taskHandle) setPaused(paused bool) {
+	h.stateLock.Lock()
+	defer h.stateLock.Unlock()
+	h.paused = paused
+}
+
+// signalGroup sends sig to the task's process and every process it started.
+// Without a known pid only the main process is signalled, through the
+// executor.
+func (h *taskHandle) signalGroup(sig os.Signal) error {
+	if h.pid > 0 {
+		return signalProcessGroup(h.pid, sig)
+	}
+	return h.exec.Signal(sig)
+}
+
 func (h *taskHandle) run() {
 	h.stateLock.Lock()
 	if h.exitResult == nil {
@@ -68,16 +165,136 @@ func (h *taskHandle) run() {
 	// TODO: wait for your task to complete and upate its state.
 	ps, err := h.exec.Wait(context.Background())
 	h.stateLock.Lock()
-	defer h.stateLock.Unlock()
-
 	if err != nil {
 		h.exitResult.Err = err
 		h.procState = drivers.TaskStateUnknown
 		h.completedAt = time.Now()
+	} else {
+		h.procState = drivers.TaskStateExited
+		h.paused = false
+		h.exitResult = h.newExitResult(ps)
+		h.completedAt = ps.Time
+	}
+	h.stateLock.Unlock()
+	close(h.doneCh)
+
+	h.emitExitEvent(ps, err)
+}
+
+// emitExitEvent classifies how the task exited so operators can tell at a
+// glance whether it succeeded, failed on its own, was killed by a signal or
+// could not be waited on at all.
+func (h *taskHandle) emitExitEvent(ps *executor.ProcessState, waitErr error) {
+	if waitErr != nil {
+		h.emitEvent(fmt.Sprintf("Failed to wait for task: %v", waitErr), map[string]string{
+			"exit_class": exitClassInfraError,
+		})
 		return
 	}
-	h.procState = drivers.TaskStateExited
-	h.exitResult.ExitCode = ps.ExitCode
-	h.exitResult.Signal = ps.Signal
-	h.completedAt = ps.Time
+
+	signal := ps.Signal
+	if signal == 0 && ps.ExitCode >= 128 {
+		signal = ps.ExitCode - 128
+	}
+
+	switch {
+	case h.livenessFailed.Load():
+		h.emitEvent("Task was stopped after failing its liveness probe", map[string]string{
+			"exit_class": exitClassLivenessFailure,
+			"exit_code":  strconv.Itoa(ps.ExitCode),
+		})
+	case h.stopRequested.Load():
+		h.emitEvent("Task was stopped by the driver", map[string]string{
+			"exit_class": exitClassStopped,
+			"exit_code":  strconv.Itoa(ps.ExitCode),
+		})
+	case ps.Signal == 0 && h.isSuccessExitCode(ps.ExitCode):
+		h.emitEvent("Task exited successfully", map[string]string{
+			"exit_class": exitClassSuccess,
+			"exit_code":  strconv.Itoa(ps.ExitCode),
+		})
+	case signal != 0:
+		name := signalName(signal)
+		h.emitEvent(fmt.Sprintf("Task was terminated by signal %s", name), map[string]string{
+			"exit_class": exitClassSignal,
+			"exit_code":  strconv.Itoa(ps.ExitCode),
+			"signal":     name,
+		})
+	default:
+		h.emitEvent(fmt.Sprintf("Task exited with application error code %d", ps.ExitCode), map[string]string{
+			"exit_class": exitClassApplicationError,
+			"exit_code":  strconv.Itoa(ps.ExitCode),
+		})
+	}
+}
+
+// isSuccessExitCode reports whether exiting with code counts as a successful
+// run. Unless the task declares success exit codes, only 0 does.
+func (h *taskHandle) isSuccessExitCode(code int) bool {
+	if len(h.successExitCodes) == 0 {
+		return code == 0
+	}
+	return slices.Contains(h.successExitCodes, code)
+}
+
+// newExitResult builds the exit result reported to Nomad for a process that
+// has exited. Declared success exit codes are reported as 0 so that Nomad
+// treats them as success, and any other exit is reported as an error unless
+// the driver stopped the task.
+func (h *taskHandle) newExitResult(ps *executor.ProcessState) *drivers.ExitResult {
+	result := &drivers.ExitResult{
+		ExitCode: ps.ExitCode,
+		Signal:   ps.Signal,
+	}
+	if ps.Signal != 0 || len(h.successExitCodes) == 0 || h.stopRequested.Load() {
+		return result
+	}
+
+	if h.isSuccessExitCode(ps.ExitCode) {
+		result.ExitCode = 0
+	} else {
+		result.Err = fmt.Errorf("exit code %d is not one of the success exit codes %v", ps.ExitCode, h.successExitCodes)
+	}
+	return result
+}
+
+// emitEvent broadcasts a task event for this task.
+// emitStartEvent reports that the task was started, along with its attempt
+// number so that logs can be lined up across restarts.
+func (h *taskHandle) emitStartEvent() {
+	h.emitEvent(fmt.Sprintf("Task started, attempt %d", h.attempt), map[string]string{
+		"attempt": strconv.Itoa(h.attempt),
+	})
+}
+
+func (h *taskHandle) emitEvent(message string, annotations map[string]string) {
+	err := h.eventer.EmitEvent(&drivers.TaskEvent{
+		TaskID:      h.taskConfig.ID,
+		TaskName:    h.taskConfig.Name,
+		AllocID:     h.taskConfig.AllocID,
+		Timestamp:   time.Now(),
+		Message:     message,
+		Annotations: annotations,
+	})
+	if err != nil {
+		h.logger.Warn("failed to emit task event", "task_id", h.taskConfig.ID, "error", err)
+	}
+}
+
+// signalName returns the conventional name of a signal number, such as
+// SIGKILL, falling back to the number itself for unknown signals.
+func signalName(signal int) string {
+	names := make([]string, 0, len(signals.SignalLookup))
+	for name := range signals.SignalLookup {
+		names = append(names, name)
+	}
+	// Some signals have aliases, so sort to pick the same name every time
+	sort.Strings(names)
+
+	for _, name := range names {
+		if sig, ok := signals.SignalLookup[name].(syscall.Signal); ok && int(sig) == signal {
+			return name
+		}
+	}
+	return fmt.Sprintf("signal %d", signal)
 }
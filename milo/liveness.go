@@ -0,0 +1,128 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package milo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+const (
+	// livenessStopTimeout is how long a task that failed its liveness probe
+	// is given to shut down before it is killed
+	livenessStopTimeout = 5 * time.Second
+)
+
+// LivenessConfig is the decoded liveness block of a task. The command is run
+// every interval, and the task is stopped once it has
+// failed FailureThreshold times in a row so that Nomad can reschedule it.
+type LivenessConfig struct {
+	Command          []string `codec:"command"`
+	Interval         string   `codec:"interval"`
+	FailureThreshold int      `codec:"failure_threshold"`
+}
+
+// validate checks the liveness block for values the schema cannot reject.
+func (c *LivenessConfig) validate() error {
+	if len(c.Command) == 0 || c.Command[0] == "" {
+		return fmt.Errorf("liveness command must not be empty")
+	}
+
+	interval, err := time.ParseDuration(c.Interval)
+	if err != nil {
+		return fmt.Errorf("invalid liveness interval %q: %v", c.Interval, err)
+	}
+	if interval <= 0 {
+		return fmt.Errorf("liveness interval %q must be positive", c.Interval)
+	}
+
+	if c.FailureThreshold < 1 {
+		return fmt.Errorf("liveness failure_threshold %d must be at least 1", c.FailureThreshold)
+	}
+
+	return nil
+}
+
+// watchLiveness runs the liveness probe of a task until the task exits, and
+// stops the task once the probe has failed too many times in a row.
+func (d *MiloDriverPlugin) watchLiveness(handle *taskHandle, liveness *LivenessConfig) {
+	taskID := handle.taskConfig.ID
+
+	interval, err := time.ParseDuration(liveness.Interval)
+	if err != nil {
+		d.logger.Error("invalid liveness interval, not probing task", "task_id", taskID, "error", err)
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-handle.doneCh:
+			return
+		case <-ticker.C:
+		}
+
+		// A paused task cannot answer its probe, so it is not probed until
+		// it is resumed
+		if handle.IsPaused() {
+			failures = 0
+			continue
+		}
+
+		// The probe gets one interval to complete
+		exitCode, err := runLivenessProbe(handle, liveness.Command, time.Now().Add(interval))
+		if err == nil && exitCode == 0 {
+			failures = 0
+			continue
+		}
+
+		failures++
+		d.logger.Debug("liveness probe failed", "task_id", taskID, "exit_code", exitCode, "error", err, "failures", failures)
+		if failures < liveness.FailureThreshold {
+			continue
+		}
+
+		handle.emitEvent(fmt.Sprintf("Liveness probe failed %d times in a row, stopping task", failures), map[string]string{
+			"liveness_failures": strconv.Itoa(failures),
+		})
+		handle.livenessFailed.Store(true)
+		if err := d.stopTask(handle, livenessStopTimeout, "SIGTERM"); err != nil {
+			d.logger.Error("failed to stop task after liveness probe failures", "task_id", taskID, "error", err)
+		}
+		return
+	}
+}
+
+// runLivenessProbe runs the probe command of a task in its task directory,
+// as the task's user and with the task's environment, and returns its exit
+// code.
+func runLivenessProbe(handle *taskHandle, command []string, deadline time.Time) (int, error) {
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	cfg := handle.taskConfig
+	probe := exec.CommandContext(ctx, command[0], command[1:]...)
+	probe.Dir = cfg.TaskDir().Dir
+	probe.Env = cfg.EnvList()
+	if err := setCommandUser(probe, cfg.User); err != nil {
+		return 0, err
+	}
+
+	var exitErr *exec.ExitError
+	if err := probe.Run(); errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	} else if err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
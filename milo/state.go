@@ -37,3 +37,14 @@ func (ts *taskStore) Delete(id string) {
 	defer ts.lock.Unlock()
 	delete(ts.store, id)
 }
+
+// List returns all stored task handles.
+func (ts *taskStore) List() []*taskHandle {
+	ts.lock.RLock()
+	defer ts.lock.RUnlock()
+	handles := make([]*taskHandle, 0, len(ts.store))
+	for _, h := range ts.store {
+		handles = append(handles, h)
+	}
+	return handles
+}
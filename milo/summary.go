@@ -0,0 +1,127 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package milo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/nomad/drivers/shared/executor"
+	"github.com/hashicorp/nomad/plugins/drivers"
+)
+
+// startSummary is the record of a launched task written to the configured
+// start_summary_path. The task environment is deliberately left out since it
+// commonly carries secrets.
+type startSummary struct {
+	TaskID    string    `json:"task_id"`
+	AllocID   string    `json:"alloc_id"`
+	TaskName  string    `json:"task_name"`
+	PID       int       `json:"pid"`
+	Command   string    `json:"command"`
+	Args      []string  `json:"args"`
+	StartedAt time.Time `json:"started_at"`
+	Attempt   int       `json:"attempt"`
+
+	MemoryLimitBytes int64 `json:"memory_limit_bytes,omitempty"`
+	CPUShares        int64 `json:"cpu_shares,omitempty"`
+}
+
+// startSummaryVars are the variables start_summary_path may reference so
+// that each task gets its own file. They are read from the task config rather
+// than the task environment, which a job can override.
+var startSummaryVars = map[string]func(cfg *drivers.TaskConfig) string{
+	"NOMAD_ALLOC_ID":  func(cfg *drivers.TaskConfig) string { return cfg.AllocID },
+	"NOMAD_JOB_NAME":  func(cfg *drivers.TaskConfig) string { return cfg.JobName },
+	"NOMAD_TASK_NAME": func(cfg *drivers.TaskConfig) string { return cfg.Name },
+}
+
+// validateStartSummaryPath checks that path is absolute and only references
+// the variables in startSummaryVars.
+func validateStartSummaryPath(path string) error {
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("must be an absolute path")
+	}
+
+	var unknown []string
+	os.Expand(path, func(key string) string {
+		if _, ok := startSummaryVars[key]; !ok {
+			unknown = append(unknown, key)
+		}
+		return ""
+	})
+	if len(unknown) > 0 {
+		return fmt.Errorf("unsupported variables %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// startSummaryPath returns where the start summary of the task is written.
+// The expanded path must stay within the directory the configured path is
+// rooted in, the part of it before any variable.
+func (d *MiloDriverPlugin) startSummaryPath(cfg *drivers.TaskConfig) (string, error) {
+	tmpl := d.config.StartSummaryPath
+	path := filepath.Clean(os.Expand(tmpl, func(key string) string {
+		if value, ok := startSummaryVars[key]; ok {
+			return value(cfg)
+		}
+		return ""
+	}))
+
+	root := tmpl
+	if i := strings.Index(root, "$"); i >= 0 {
+		root = root[:i]
+	}
+	root = filepath.Dir(root)
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("start summary path %q is outside of %s", path, root)
+	}
+	return path, nil
+}
+
+// writeStartSummary writes a JSON summary of a launched task if
+// start_summary_path is configured.
+func (d *MiloDriverPlugin) writeStartSummary(cfg *drivers.TaskConfig, execCmd *executor.ExecCommand, h *taskHandle) error {
+	if d.config.StartSummaryPath == "" {
+		return nil
+	}
+
+	summary := startSummary{
+		TaskID:    cfg.ID,
+		AllocID:   cfg.AllocID,
+		TaskName:  cfg.Name,
+		PID:       h.pid,
+		Command:   execCmd.Cmd,
+		Args:      execCmd.Args,
+		StartedAt: h.startedAt,
+		Attempt:   h.attempt,
+	}
+	if cfg.Resources != nil && cfg.Resources.LinuxResources != nil {
+		summary.MemoryLimitBytes = cfg.Resources.LinuxResources.MemoryLimitBytes
+		summary.CPUShares = cfg.Resources.LinuxResources.CPUShares
+	}
+
+	out, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode start summary: %v", err)
+	}
+
+	path, err := d.startSummaryPath(cfg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create start summary directory: %v", err)
+	}
+	if err := os.WriteFile(path, append(out, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write start summary: %v", err)
+	}
+	return nil
+}